@@ -0,0 +1,225 @@
+//Package NeexTrx comment
+// This file war generated by tars2go 1.1
+// Generated from FreezingSys.tars
+package NeexTrx
+
+import (
+	"fmt"
+	"github.com/TarsCloud/TarsGo/tars/protocol/codec"
+)
+
+//DepositInfo strcut implement
+type DepositInfo struct {
+	Hash          string `json:"hash"`
+	Symbol        string `json:"symbol"`
+	Amount        string `json:"amount"`
+	Type          int32  `json:"type"`
+	Sender        string `json:"sender"`
+	Account       string `json:"account"`
+	Uid           int64  `json:"uid"`
+	Memo          string `json:"memo"`
+	BlockNum      int64  `json:"blockNum"`
+	BlockTime     int64  `json:"blockTime"`
+	ActionOrdinal int32  `json:"actionOrdinal"`
+	Status        string `json:"status"`
+	Contract      string `json:"contract"`
+}
+
+func (st *DepositInfo) resetDefault() {
+}
+
+//ReadFrom reads  from _is and put into struct.
+func (st *DepositInfo) ReadFrom(_is *codec.Reader) error {
+	var err error
+	var length int32
+	var have bool
+	var ty byte
+	st.resetDefault()
+
+	err = _is.Read_string(&st.Hash, 1, true)
+	if err != nil {
+		return err
+	}
+
+	err = _is.Read_string(&st.Symbol, 2, true)
+	if err != nil {
+		return err
+	}
+
+	err = _is.Read_string(&st.Amount, 3, true)
+	if err != nil {
+		return err
+	}
+
+	err = _is.Read_int32(&st.Type, 4, true)
+	if err != nil {
+		return err
+	}
+
+	err = _is.Read_string(&st.Sender, 5, true)
+	if err != nil {
+		return err
+	}
+
+	err = _is.Read_string(&st.Account, 6, true)
+	if err != nil {
+		return err
+	}
+
+	err = _is.Read_int64(&st.Uid, 7, true)
+	if err != nil {
+		return err
+	}
+
+	err = _is.Read_string(&st.Memo, 8, true)
+	if err != nil {
+		return err
+	}
+
+	err = _is.Read_int64(&st.BlockNum, 9, true)
+	if err != nil {
+		return err
+	}
+
+	err = _is.Read_int64(&st.BlockTime, 10, true)
+	if err != nil {
+		return err
+	}
+
+	err = _is.Read_int32(&st.ActionOrdinal, 11, true)
+	if err != nil {
+		return err
+	}
+
+	err = _is.Read_string(&st.Status, 12, true)
+	if err != nil {
+		return err
+	}
+
+	err = _is.Read_string(&st.Contract, 13, false)
+	if err != nil {
+		return err
+	}
+
+	_ = length
+	_ = have
+	_ = ty
+	return nil
+}
+
+//ReadBlock reads struct from the given tag , require or optional.
+func (st *DepositInfo) ReadBlock(_is *codec.Reader, tag byte, require bool) error {
+	var err error
+	var have bool
+	st.resetDefault()
+
+	err, have = _is.SkipTo(codec.STRUCT_BEGIN, tag, require)
+	if err != nil {
+		return err
+	}
+	if !have {
+		if require {
+			return fmt.Errorf("require DepositInfo, but not exist. tag %d", tag)
+		}
+		return nil
+
+	}
+
+	st.ReadFrom(_is)
+
+	err = _is.SkipToStructEnd()
+	if err != nil {
+		return err
+	}
+	_ = have
+	return nil
+}
+
+//WriteTo encode struct to buffer
+func (st *DepositInfo) WriteTo(_os *codec.Buffer) error {
+	var err error
+
+	err = _os.Write_string(st.Hash, 1)
+	if err != nil {
+		return err
+	}
+
+	err = _os.Write_string(st.Symbol, 2)
+	if err != nil {
+		return err
+	}
+
+	err = _os.Write_string(st.Amount, 3)
+	if err != nil {
+		return err
+	}
+
+	err = _os.Write_int32(st.Type, 4)
+	if err != nil {
+		return err
+	}
+
+	err = _os.Write_string(st.Sender, 5)
+	if err != nil {
+		return err
+	}
+
+	err = _os.Write_string(st.Account, 6)
+	if err != nil {
+		return err
+	}
+
+	err = _os.Write_int64(st.Uid, 7)
+	if err != nil {
+		return err
+	}
+
+	err = _os.Write_string(st.Memo, 8)
+	if err != nil {
+		return err
+	}
+
+	err = _os.Write_int64(st.BlockNum, 9)
+	if err != nil {
+		return err
+	}
+
+	err = _os.Write_int64(st.BlockTime, 10)
+	if err != nil {
+		return err
+	}
+
+	err = _os.Write_int32(st.ActionOrdinal, 11)
+	if err != nil {
+		return err
+	}
+
+	err = _os.Write_string(st.Status, 12)
+	if err != nil {
+		return err
+	}
+
+	err = _os.Write_string(st.Contract, 13)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//WriteBlock encode struct
+func (st *DepositInfo) WriteBlock(_os *codec.Buffer, tag byte) error {
+	var err error
+	err = _os.WriteHead(codec.STRUCT_BEGIN, tag)
+	if err != nil {
+		return err
+	}
+
+	st.WriteTo(_os)
+
+	err = _os.WriteHead(codec.STRUCT_END, 0)
+	if err != nil {
+		return err
+	}
+	return nil
+}
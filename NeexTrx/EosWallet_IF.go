@@ -0,0 +1,915 @@
+//Package NeexTrx comment
+// This file war generated by tars2go 1.1
+// Generated from EosWallet.tars
+package NeexTrx
+
+import (
+	"context"
+	"fmt"
+	"github.com/TarsCloud/TarsGo/tars"
+	m "github.com/TarsCloud/TarsGo/tars/model"
+	"github.com/TarsCloud/TarsGo/tars/protocol/codec"
+	"github.com/TarsCloud/TarsGo/tars/protocol/res/requestf"
+	"github.com/TarsCloud/TarsGo/tars/util/current"
+	"github.com/TarsCloud/TarsGo/tars/util/tools"
+)
+
+//EosWallet struct
+type EosWallet struct {
+	s m.Servant
+}
+
+//Send is the proxy function for the method defined in the tars file, with the context
+func (_obj *EosWallet) Send(Symbol string, To string, Amount string, Memo string, Hash *string, Reason *string, _opt ...map[string]string) (ret bool, err error) {
+
+	var length int32
+	var have bool
+	var ty byte
+	_os := codec.NewBuffer()
+	err = _os.Write_string(Symbol, 1)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(To, 2)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Amount, 3)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Memo, 4)
+	if err != nil {
+		return ret, err
+	}
+
+	var _status map[string]string
+	var _context map[string]string
+	if len(_opt) == 1 {
+		_context = _opt[0]
+	} else if len(_opt) == 2 {
+		_context = _opt[0]
+		_status = _opt[1]
+	}
+	_resp := new(requestf.ResponsePacket)
+	ctx := context.Background()
+	err = _obj.s.Tars_invoke(ctx, 0, "send", _os.ToBytes(), _status, _context, _resp)
+	if err != nil {
+		return ret, err
+	}
+	_is := codec.NewReader(tools.Int8ToByte(_resp.SBuffer))
+	err = _is.Read_bool(&ret, 0, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Hash), 5, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Reason), 6, true)
+	if err != nil {
+		return ret, err
+	}
+
+	_obj.setMap(len(_opt), _resp, _context, _status)
+	_ = length
+	_ = have
+	_ = ty
+	return ret, nil
+}
+
+//SendWithContext is the proxy function for the method defined in the tars file, with the context
+func (_obj *EosWallet) SendWithContext(ctx context.Context, Symbol string, To string, Amount string, Memo string, Hash *string, Reason *string, _opt ...map[string]string) (ret bool, err error) {
+
+	var length int32
+	var have bool
+	var ty byte
+	_os := codec.NewBuffer()
+	err = _os.Write_string(Symbol, 1)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(To, 2)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Amount, 3)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Memo, 4)
+	if err != nil {
+		return ret, err
+	}
+
+	var _status map[string]string
+	var _context map[string]string
+	if len(_opt) == 1 {
+		_context = _opt[0]
+	} else if len(_opt) == 2 {
+		_context = _opt[0]
+		_status = _opt[1]
+	}
+	_resp := new(requestf.ResponsePacket)
+	err = _obj.s.Tars_invoke(ctx, 0, "send", _os.ToBytes(), _status, _context, _resp)
+	if err != nil {
+		return ret, err
+	}
+	_is := codec.NewReader(tools.Int8ToByte(_resp.SBuffer))
+	err = _is.Read_bool(&ret, 0, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Hash), 5, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Reason), 6, true)
+	if err != nil {
+		return ret, err
+	}
+
+	_obj.setMap(len(_opt), _resp, _context, _status)
+	_ = length
+	_ = have
+	_ = ty
+	return ret, nil
+}
+
+//Balance is the proxy function for the method defined in the tars file, with the context
+func (_obj *EosWallet) Balance(Symbol string, Address string, Balance *string, Reason *string, _opt ...map[string]string) (ret bool, err error) {
+
+	var length int32
+	var have bool
+	var ty byte
+	_os := codec.NewBuffer()
+	err = _os.Write_string(Symbol, 1)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Address, 2)
+	if err != nil {
+		return ret, err
+	}
+
+	var _status map[string]string
+	var _context map[string]string
+	if len(_opt) == 1 {
+		_context = _opt[0]
+	} else if len(_opt) == 2 {
+		_context = _opt[0]
+		_status = _opt[1]
+	}
+	_resp := new(requestf.ResponsePacket)
+	ctx := context.Background()
+	err = _obj.s.Tars_invoke(ctx, 0, "balance", _os.ToBytes(), _status, _context, _resp)
+	if err != nil {
+		return ret, err
+	}
+	_is := codec.NewReader(tools.Int8ToByte(_resp.SBuffer))
+	err = _is.Read_bool(&ret, 0, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Balance), 3, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Reason), 4, true)
+	if err != nil {
+		return ret, err
+	}
+
+	_obj.setMap(len(_opt), _resp, _context, _status)
+	_ = length
+	_ = have
+	_ = ty
+	return ret, nil
+}
+
+//BalanceWithContext is the proxy function for the method defined in the tars file, with the context
+func (_obj *EosWallet) BalanceWithContext(ctx context.Context, Symbol string, Address string, Balance *string, Reason *string, _opt ...map[string]string) (ret bool, err error) {
+
+	var length int32
+	var have bool
+	var ty byte
+	_os := codec.NewBuffer()
+	err = _os.Write_string(Symbol, 1)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Address, 2)
+	if err != nil {
+		return ret, err
+	}
+
+	var _status map[string]string
+	var _context map[string]string
+	if len(_opt) == 1 {
+		_context = _opt[0]
+	} else if len(_opt) == 2 {
+		_context = _opt[0]
+		_status = _opt[1]
+	}
+	_resp := new(requestf.ResponsePacket)
+	err = _obj.s.Tars_invoke(ctx, 0, "balance", _os.ToBytes(), _status, _context, _resp)
+	if err != nil {
+		return ret, err
+	}
+	_is := codec.NewReader(tools.Int8ToByte(_resp.SBuffer))
+	err = _is.Read_bool(&ret, 0, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Balance), 3, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Reason), 4, true)
+	if err != nil {
+		return ret, err
+	}
+
+	_obj.setMap(len(_opt), _resp, _context, _status)
+	_ = length
+	_ = have
+	_ = ty
+	return ret, nil
+}
+
+//CheckAddr is the proxy function for the method defined in the tars file, with the context
+func (_obj *EosWallet) CheckAddr(Address string, _opt ...map[string]string) (ret bool, err error) {
+
+	var length int32
+	var have bool
+	var ty byte
+	_os := codec.NewBuffer()
+	err = _os.Write_string(Address, 1)
+	if err != nil {
+		return ret, err
+	}
+
+	var _status map[string]string
+	var _context map[string]string
+	if len(_opt) == 1 {
+		_context = _opt[0]
+	} else if len(_opt) == 2 {
+		_context = _opt[0]
+		_status = _opt[1]
+	}
+	_resp := new(requestf.ResponsePacket)
+	ctx := context.Background()
+	err = _obj.s.Tars_invoke(ctx, 0, "checkAddr", _os.ToBytes(), _status, _context, _resp)
+	if err != nil {
+		return ret, err
+	}
+	_is := codec.NewReader(tools.Int8ToByte(_resp.SBuffer))
+	err = _is.Read_bool(&ret, 0, true)
+	if err != nil {
+		return ret, err
+	}
+
+	_obj.setMap(len(_opt), _resp, _context, _status)
+	_ = length
+	_ = have
+	_ = ty
+	return ret, nil
+}
+
+//CheckAddrWithContext is the proxy function for the method defined in the tars file, with the context
+func (_obj *EosWallet) CheckAddrWithContext(ctx context.Context, Address string, _opt ...map[string]string) (ret bool, err error) {
+
+	var length int32
+	var have bool
+	var ty byte
+	_os := codec.NewBuffer()
+	err = _os.Write_string(Address, 1)
+	if err != nil {
+		return ret, err
+	}
+
+	var _status map[string]string
+	var _context map[string]string
+	if len(_opt) == 1 {
+		_context = _opt[0]
+	} else if len(_opt) == 2 {
+		_context = _opt[0]
+		_status = _opt[1]
+	}
+	_resp := new(requestf.ResponsePacket)
+	err = _obj.s.Tars_invoke(ctx, 0, "checkAddr", _os.ToBytes(), _status, _context, _resp)
+	if err != nil {
+		return ret, err
+	}
+	_is := codec.NewReader(tools.Int8ToByte(_resp.SBuffer))
+	err = _is.Read_bool(&ret, 0, true)
+	if err != nil {
+		return ret, err
+	}
+
+	_obj.setMap(len(_opt), _resp, _context, _status)
+	_ = length
+	_ = have
+	_ = ty
+	return ret, nil
+}
+
+//Memo is the proxy function for the method defined in the tars file, with the context
+func (_obj *EosWallet) Memo(Account string, Uid int64, Memo *string, Reason *string, _opt ...map[string]string) (ret bool, err error) {
+
+	var length int32
+	var have bool
+	var ty byte
+	_os := codec.NewBuffer()
+	err = _os.Write_string(Account, 1)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_int64(Uid, 2)
+	if err != nil {
+		return ret, err
+	}
+
+	var _status map[string]string
+	var _context map[string]string
+	if len(_opt) == 1 {
+		_context = _opt[0]
+	} else if len(_opt) == 2 {
+		_context = _opt[0]
+		_status = _opt[1]
+	}
+	_resp := new(requestf.ResponsePacket)
+	ctx := context.Background()
+	err = _obj.s.Tars_invoke(ctx, 0, "memo", _os.ToBytes(), _status, _context, _resp)
+	if err != nil {
+		return ret, err
+	}
+	_is := codec.NewReader(tools.Int8ToByte(_resp.SBuffer))
+	err = _is.Read_bool(&ret, 0, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Memo), 3, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Reason), 4, true)
+	if err != nil {
+		return ret, err
+	}
+
+	_obj.setMap(len(_opt), _resp, _context, _status)
+	_ = length
+	_ = have
+	_ = ty
+	return ret, nil
+}
+
+//MemoWithContext is the proxy function for the method defined in the tars file, with the context
+func (_obj *EosWallet) MemoWithContext(ctx context.Context, Account string, Uid int64, Memo *string, Reason *string, _opt ...map[string]string) (ret bool, err error) {
+
+	var length int32
+	var have bool
+	var ty byte
+	_os := codec.NewBuffer()
+	err = _os.Write_string(Account, 1)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_int64(Uid, 2)
+	if err != nil {
+		return ret, err
+	}
+
+	var _status map[string]string
+	var _context map[string]string
+	if len(_opt) == 1 {
+		_context = _opt[0]
+	} else if len(_opt) == 2 {
+		_context = _opt[0]
+		_status = _opt[1]
+	}
+	_resp := new(requestf.ResponsePacket)
+	err = _obj.s.Tars_invoke(ctx, 0, "memo", _os.ToBytes(), _status, _context, _resp)
+	if err != nil {
+		return ret, err
+	}
+	_is := codec.NewReader(tools.Int8ToByte(_resp.SBuffer))
+	err = _is.Read_bool(&ret, 0, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Memo), 3, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Reason), 4, true)
+	if err != nil {
+		return ret, err
+	}
+
+	_obj.setMap(len(_opt), _resp, _context, _status)
+	_ = length
+	_ = have
+	_ = ty
+	return ret, nil
+}
+
+//TxStatus is the proxy function for the method defined in the tars file, with the context
+func (_obj *EosWallet) TxStatus(Hash string, Status *string, Reason *string, _opt ...map[string]string) (ret bool, err error) {
+
+	var length int32
+	var have bool
+	var ty byte
+	_os := codec.NewBuffer()
+	err = _os.Write_string(Hash, 1)
+	if err != nil {
+		return ret, err
+	}
+
+	var _status map[string]string
+	var _context map[string]string
+	if len(_opt) == 1 {
+		_context = _opt[0]
+	} else if len(_opt) == 2 {
+		_context = _opt[0]
+		_status = _opt[1]
+	}
+	_resp := new(requestf.ResponsePacket)
+	ctx := context.Background()
+	err = _obj.s.Tars_invoke(ctx, 0, "txStatus", _os.ToBytes(), _status, _context, _resp)
+	if err != nil {
+		return ret, err
+	}
+	_is := codec.NewReader(tools.Int8ToByte(_resp.SBuffer))
+	err = _is.Read_bool(&ret, 0, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Status), 2, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Reason), 3, true)
+	if err != nil {
+		return ret, err
+	}
+
+	_obj.setMap(len(_opt), _resp, _context, _status)
+	_ = length
+	_ = have
+	_ = ty
+	return ret, nil
+}
+
+//TxStatusWithContext is the proxy function for the method defined in the tars file, with the context
+func (_obj *EosWallet) TxStatusWithContext(ctx context.Context, Hash string, Status *string, Reason *string, _opt ...map[string]string) (ret bool, err error) {
+
+	var length int32
+	var have bool
+	var ty byte
+	_os := codec.NewBuffer()
+	err = _os.Write_string(Hash, 1)
+	if err != nil {
+		return ret, err
+	}
+
+	var _status map[string]string
+	var _context map[string]string
+	if len(_opt) == 1 {
+		_context = _opt[0]
+	} else if len(_opt) == 2 {
+		_context = _opt[0]
+		_status = _opt[1]
+	}
+	_resp := new(requestf.ResponsePacket)
+	err = _obj.s.Tars_invoke(ctx, 0, "txStatus", _os.ToBytes(), _status, _context, _resp)
+	if err != nil {
+		return ret, err
+	}
+	_is := codec.NewReader(tools.Int8ToByte(_resp.SBuffer))
+	err = _is.Read_bool(&ret, 0, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Status), 2, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Reason), 3, true)
+	if err != nil {
+		return ret, err
+	}
+
+	_obj.setMap(len(_opt), _resp, _context, _status)
+	_ = length
+	_ = have
+	_ = ty
+	return ret, nil
+}
+
+//SetServant sets servant for the service.
+func (_obj *EosWallet) SetServant(s m.Servant) {
+	_obj.s = s
+}
+
+//TarsSetTimeout sets the timeout for the servant which is in ms.
+func (_obj *EosWallet) TarsSetTimeout(t int) {
+	_obj.s.TarsSetTimeout(t)
+}
+func (_obj *EosWallet) setMap(l int, res *requestf.ResponsePacket, ctx map[string]string, sts map[string]string) {
+	if l == 1 {
+		for k, _ := range ctx {
+			delete(ctx, k)
+		}
+		for k, v := range res.Context {
+			ctx[k] = v
+		}
+	} else if l == 2 {
+		for k, _ := range ctx {
+			delete(ctx, k)
+		}
+		for k, v := range res.Context {
+			ctx[k] = v
+		}
+		for k, _ := range sts {
+			delete(sts, k)
+		}
+		for k, v := range res.Status {
+			sts[k] = v
+		}
+	}
+}
+
+//AddServant adds servant  for the service.
+func (_obj *EosWallet) AddServant(imp _impEosWallet, obj string) {
+	tars.AddServant(_obj, imp, obj)
+}
+
+//AddServant adds servant  for the service with context.
+func (_obj *EosWallet) AddServantWithContext(imp _impEosWalletWithContext, obj string) {
+	tars.AddServantWithContext(_obj, imp, obj)
+}
+
+type _impEosWallet interface {
+	Send(Symbol string, To string, Amount string, Memo string, Hash *string, Reason *string) (ret bool, err error)
+	Balance(Symbol string, Address string, Balance *string, Reason *string) (ret bool, err error)
+	CheckAddr(Address string) (ret bool, err error)
+	Memo(Account string, Uid int64, Memo *string, Reason *string) (ret bool, err error)
+	TxStatus(Hash string, Status *string, Reason *string) (ret bool, err error)
+}
+type _impEosWalletWithContext interface {
+	Send(ctx context.Context, Symbol string, To string, Amount string, Memo string, Hash *string, Reason *string) (ret bool, err error)
+	Balance(ctx context.Context, Symbol string, Address string, Balance *string, Reason *string) (ret bool, err error)
+	CheckAddr(ctx context.Context, Address string) (ret bool, err error)
+	Memo(ctx context.Context, Account string, Uid int64, Memo *string, Reason *string) (ret bool, err error)
+	TxStatus(ctx context.Context, Hash string, Status *string, Reason *string) (ret bool, err error)
+}
+
+func send(ctx context.Context, _val interface{}, _os *codec.Buffer, _is *codec.Reader, withContext bool) (err error) {
+	var length int32
+	var have bool
+	var ty byte
+	var Symbol string
+	err = _is.Read_string(&Symbol, 1, true)
+	if err != nil {
+		return err
+	}
+	var To string
+	err = _is.Read_string(&To, 2, true)
+	if err != nil {
+		return err
+	}
+	var Amount string
+	err = _is.Read_string(&Amount, 3, true)
+	if err != nil {
+		return err
+	}
+	var Memo string
+	err = _is.Read_string(&Memo, 4, true)
+	if err != nil {
+		return err
+	}
+	var Hash string
+	var Reason string
+	if withContext == false {
+		_imp := _val.(_impEosWallet)
+		ret, err := _imp.Send(Symbol, To, Amount, Memo, &Hash, &Reason)
+		if err != nil {
+			return err
+		}
+
+		err = _os.Write_bool(ret, 0)
+		if err != nil {
+			return err
+		}
+	} else {
+		_imp := _val.(_impEosWalletWithContext)
+		ret, err := _imp.Send(ctx, Symbol, To, Amount, Memo, &Hash, &Reason)
+		if err != nil {
+			return err
+		}
+
+		err = _os.Write_bool(ret, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = _os.Write_string(Hash, 5)
+	if err != nil {
+		return err
+	}
+
+	err = _os.Write_string(Reason, 6)
+	if err != nil {
+		return err
+	}
+
+	_ = length
+	_ = have
+	_ = ty
+	return nil
+}
+func balance(ctx context.Context, _val interface{}, _os *codec.Buffer, _is *codec.Reader, withContext bool) (err error) {
+	var length int32
+	var have bool
+	var ty byte
+	var Symbol string
+	err = _is.Read_string(&Symbol, 1, true)
+	if err != nil {
+		return err
+	}
+	var Address string
+	err = _is.Read_string(&Address, 2, true)
+	if err != nil {
+		return err
+	}
+	var Balance string
+	var Reason string
+	if withContext == false {
+		_imp := _val.(_impEosWallet)
+		ret, err := _imp.Balance(Symbol, Address, &Balance, &Reason)
+		if err != nil {
+			return err
+		}
+
+		err = _os.Write_bool(ret, 0)
+		if err != nil {
+			return err
+		}
+	} else {
+		_imp := _val.(_impEosWalletWithContext)
+		ret, err := _imp.Balance(ctx, Symbol, Address, &Balance, &Reason)
+		if err != nil {
+			return err
+		}
+
+		err = _os.Write_bool(ret, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = _os.Write_string(Balance, 3)
+	if err != nil {
+		return err
+	}
+
+	err = _os.Write_string(Reason, 4)
+	if err != nil {
+		return err
+	}
+
+	_ = length
+	_ = have
+	_ = ty
+	return nil
+}
+func checkAddr(ctx context.Context, _val interface{}, _os *codec.Buffer, _is *codec.Reader, withContext bool) (err error) {
+	var length int32
+	var have bool
+	var ty byte
+	var Address string
+	err = _is.Read_string(&Address, 1, true)
+	if err != nil {
+		return err
+	}
+	if withContext == false {
+		_imp := _val.(_impEosWallet)
+		ret, err := _imp.CheckAddr(Address)
+		if err != nil {
+			return err
+		}
+
+		err = _os.Write_bool(ret, 0)
+		if err != nil {
+			return err
+		}
+	} else {
+		_imp := _val.(_impEosWalletWithContext)
+		ret, err := _imp.CheckAddr(ctx, Address)
+		if err != nil {
+			return err
+		}
+
+		err = _os.Write_bool(ret, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	_ = length
+	_ = have
+	_ = ty
+	return nil
+}
+func memo(ctx context.Context, _val interface{}, _os *codec.Buffer, _is *codec.Reader, withContext bool) (err error) {
+	var length int32
+	var have bool
+	var ty byte
+	var Account string
+	err = _is.Read_string(&Account, 1, true)
+	if err != nil {
+		return err
+	}
+	var Uid int64
+	err = _is.Read_int64(&Uid, 2, true)
+	if err != nil {
+		return err
+	}
+	var Memo string
+	var Reason string
+	if withContext == false {
+		_imp := _val.(_impEosWallet)
+		ret, err := _imp.Memo(Account, Uid, &Memo, &Reason)
+		if err != nil {
+			return err
+		}
+
+		err = _os.Write_bool(ret, 0)
+		if err != nil {
+			return err
+		}
+	} else {
+		_imp := _val.(_impEosWalletWithContext)
+		ret, err := _imp.Memo(ctx, Account, Uid, &Memo, &Reason)
+		if err != nil {
+			return err
+		}
+
+		err = _os.Write_bool(ret, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = _os.Write_string(Memo, 3)
+	if err != nil {
+		return err
+	}
+
+	err = _os.Write_string(Reason, 4)
+	if err != nil {
+		return err
+	}
+
+	_ = length
+	_ = have
+	_ = ty
+	return nil
+}
+func txStatus(ctx context.Context, _val interface{}, _os *codec.Buffer, _is *codec.Reader, withContext bool) (err error) {
+	var length int32
+	var have bool
+	var ty byte
+	var Hash string
+	err = _is.Read_string(&Hash, 1, true)
+	if err != nil {
+		return err
+	}
+	var Status string
+	var Reason string
+	if withContext == false {
+		_imp := _val.(_impEosWallet)
+		ret, err := _imp.TxStatus(Hash, &Status, &Reason)
+		if err != nil {
+			return err
+		}
+
+		err = _os.Write_bool(ret, 0)
+		if err != nil {
+			return err
+		}
+	} else {
+		_imp := _val.(_impEosWalletWithContext)
+		ret, err := _imp.TxStatus(ctx, Hash, &Status, &Reason)
+		if err != nil {
+			return err
+		}
+
+		err = _os.Write_bool(ret, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = _os.Write_string(Status, 2)
+	if err != nil {
+		return err
+	}
+
+	err = _os.Write_string(Reason, 3)
+	if err != nil {
+		return err
+	}
+
+	_ = length
+	_ = have
+	_ = ty
+	return nil
+}
+
+//Dispatch is used to call the server side implemnet for the method defined in the tars file. withContext shows using context or not.
+func (_obj *EosWallet) Dispatch(ctx context.Context, _val interface{}, req *requestf.RequestPacket, resp *requestf.ResponsePacket, withContext bool) (err error) {
+	_is := codec.NewReader(tools.Int8ToByte(req.SBuffer))
+	_os := codec.NewBuffer()
+	switch req.SFuncName {
+	case "send":
+		err := send(ctx, _val, _os, _is, withContext)
+		if err != nil {
+			return err
+		}
+	case "balance":
+		err := balance(ctx, _val, _os, _is, withContext)
+		if err != nil {
+			return err
+		}
+	case "checkAddr":
+		err := checkAddr(ctx, _val, _os, _is, withContext)
+		if err != nil {
+			return err
+		}
+	case "memo":
+		err := memo(ctx, _val, _os, _is, withContext)
+		if err != nil {
+			return err
+		}
+	case "txStatus":
+		err := txStatus(ctx, _val, _os, _is, withContext)
+		if err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("func mismatch")
+	}
+	var _status map[string]string
+	s, ok := current.GetResponseStatus(ctx)
+	if ok && s != nil {
+		_status = s
+	}
+	var _context map[string]string
+	c, ok := current.GetResponseContext(ctx)
+	if ok && c != nil {
+		_context = c
+	}
+	*resp = requestf.ResponsePacket{
+		IVersion:     1,
+		CPacketType:  0,
+		IRequestId:   req.IRequestId,
+		IMessageType: 0,
+		IRet:         0,
+		SBuffer:      tools.ByteToInt8(_os.ToBytes()),
+		Status:       _status,
+		SResultDesc:  "",
+		Context:      _context,
+	}
+	return nil
+}
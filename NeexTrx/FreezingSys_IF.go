@@ -350,6 +350,367 @@ func (_obj *FreezingSys) Insert_innerexchange_feeWithContext(ctx context.Context
 	return ret, nil
 }
 
+//User_into_dc3 is the proxy function for the method defined in the tars file, with the context
+func (_obj *FreezingSys) User_into_dc3(Info *DepositInfo, Rsp *string, _opt ...map[string]string) (ret bool, err error) {
+
+	var length int32
+	var have bool
+	var ty byte
+	_os := codec.NewBuffer()
+	err = Info.WriteBlock(_os, 1)
+	if err != nil {
+		return ret, err
+	}
+
+	var _status map[string]string
+	var _context map[string]string
+	if len(_opt) == 1 {
+		_context = _opt[0]
+	} else if len(_opt) == 2 {
+		_context = _opt[0]
+		_status = _opt[1]
+	}
+	_resp := new(requestf.ResponsePacket)
+	ctx := context.Background()
+	err = _obj.s.Tars_invoke(ctx, 0, "user_into_dc3", _os.ToBytes(), _status, _context, _resp)
+	if err != nil {
+		return ret, err
+	}
+	_is := codec.NewReader(tools.Int8ToByte(_resp.SBuffer))
+	err = _is.Read_bool(&ret, 0, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Rsp), 2, true)
+	if err != nil {
+		return ret, err
+	}
+
+	_obj.setMap(len(_opt), _resp, _context, _status)
+	_ = length
+	_ = have
+	_ = ty
+	return ret, nil
+}
+
+//User_into_dc3WithContext is the proxy function for the method defined in the tars file, with the context
+func (_obj *FreezingSys) User_into_dc3WithContext(ctx context.Context, Info *DepositInfo, Rsp *string, _opt ...map[string]string) (ret bool, err error) {
+
+	var length int32
+	var have bool
+	var ty byte
+	_os := codec.NewBuffer()
+	err = Info.WriteBlock(_os, 1)
+	if err != nil {
+		return ret, err
+	}
+
+	var _status map[string]string
+	var _context map[string]string
+	if len(_opt) == 1 {
+		_context = _opt[0]
+	} else if len(_opt) == 2 {
+		_context = _opt[0]
+		_status = _opt[1]
+	}
+	_resp := new(requestf.ResponsePacket)
+	err = _obj.s.Tars_invoke(ctx, 0, "user_into_dc3", _os.ToBytes(), _status, _context, _resp)
+	if err != nil {
+		return ret, err
+	}
+	_is := codec.NewReader(tools.Int8ToByte(_resp.SBuffer))
+	err = _is.Read_bool(&ret, 0, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Rsp), 2, true)
+	if err != nil {
+		return ret, err
+	}
+
+	_obj.setMap(len(_opt), _resp, _context, _status)
+	_ = length
+	_ = have
+	_ = ty
+	return ret, nil
+}
+
+//Withdraw_failed_dc is the proxy function for the method defined in the tars file, with the context
+func (_obj *FreezingSys) Withdraw_failed_dc(Hash string, Symbol string, Amount string, Status string, Reason string, Rsp *string, _opt ...map[string]string) (ret bool, err error) {
+
+	var length int32
+	var have bool
+	var ty byte
+	_os := codec.NewBuffer()
+	err = _os.Write_string(Hash, 1)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Symbol, 2)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Amount, 3)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Status, 4)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Reason, 5)
+	if err != nil {
+		return ret, err
+	}
+
+	var _status map[string]string
+	var _context map[string]string
+	if len(_opt) == 1 {
+		_context = _opt[0]
+	} else if len(_opt) == 2 {
+		_context = _opt[0]
+		_status = _opt[1]
+	}
+	_resp := new(requestf.ResponsePacket)
+	ctx := context.Background()
+	err = _obj.s.Tars_invoke(ctx, 0, "withdraw_failed_dc", _os.ToBytes(), _status, _context, _resp)
+	if err != nil {
+		return ret, err
+	}
+	_is := codec.NewReader(tools.Int8ToByte(_resp.SBuffer))
+	err = _is.Read_bool(&ret, 0, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Rsp), 6, true)
+	if err != nil {
+		return ret, err
+	}
+
+	_obj.setMap(len(_opt), _resp, _context, _status)
+	_ = length
+	_ = have
+	_ = ty
+	return ret, nil
+}
+
+//Withdraw_failed_dcWithContext is the proxy function for the method defined in the tars file, with the context
+func (_obj *FreezingSys) Withdraw_failed_dcWithContext(ctx context.Context, Hash string, Symbol string, Amount string, Status string, Reason string, Rsp *string, _opt ...map[string]string) (ret bool, err error) {
+
+	var length int32
+	var have bool
+	var ty byte
+	_os := codec.NewBuffer()
+	err = _os.Write_string(Hash, 1)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Symbol, 2)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Amount, 3)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Status, 4)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Reason, 5)
+	if err != nil {
+		return ret, err
+	}
+
+	var _status map[string]string
+	var _context map[string]string
+	if len(_opt) == 1 {
+		_context = _opt[0]
+	} else if len(_opt) == 2 {
+		_context = _opt[0]
+		_status = _opt[1]
+	}
+	_resp := new(requestf.ResponsePacket)
+	err = _obj.s.Tars_invoke(ctx, 0, "withdraw_failed_dc", _os.ToBytes(), _status, _context, _resp)
+	if err != nil {
+		return ret, err
+	}
+	_is := codec.NewReader(tools.Int8ToByte(_resp.SBuffer))
+	err = _is.Read_bool(&ret, 0, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Rsp), 6, true)
+	if err != nil {
+		return ret, err
+	}
+
+	_obj.setMap(len(_opt), _resp, _context, _status)
+	_ = length
+	_ = have
+	_ = ty
+	return ret, nil
+}
+
+//Revert_dc is the proxy function for the method defined in the tars file, with the context
+func (_obj *FreezingSys) Revert_dc(Hash string, ActionOrdinal int32, Kind string, Symbol string, Amount string, Addr string, Type int32, Rsp *string, _opt ...map[string]string) (ret bool, err error) {
+
+	var length int32
+	var have bool
+	var ty byte
+	_os := codec.NewBuffer()
+	err = _os.Write_string(Hash, 1)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_int32(ActionOrdinal, 2)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Kind, 3)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Symbol, 4)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Amount, 5)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Addr, 6)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_int32(Type, 7)
+	if err != nil {
+		return ret, err
+	}
+
+	var _status map[string]string
+	var _context map[string]string
+	if len(_opt) == 1 {
+		_context = _opt[0]
+	} else if len(_opt) == 2 {
+		_context = _opt[0]
+		_status = _opt[1]
+	}
+	_resp := new(requestf.ResponsePacket)
+	ctx := context.Background()
+	err = _obj.s.Tars_invoke(ctx, 0, "revert_dc", _os.ToBytes(), _status, _context, _resp)
+	if err != nil {
+		return ret, err
+	}
+	_is := codec.NewReader(tools.Int8ToByte(_resp.SBuffer))
+	err = _is.Read_bool(&ret, 0, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Rsp), 8, true)
+	if err != nil {
+		return ret, err
+	}
+
+	_obj.setMap(len(_opt), _resp, _context, _status)
+	_ = length
+	_ = have
+	_ = ty
+	return ret, nil
+}
+
+//Revert_dcWithContext is the proxy function for the method defined in the tars file, with the context
+func (_obj *FreezingSys) Revert_dcWithContext(ctx context.Context, Hash string, ActionOrdinal int32, Kind string, Symbol string, Amount string, Addr string, Type int32, Rsp *string, _opt ...map[string]string) (ret bool, err error) {
+
+	var length int32
+	var have bool
+	var ty byte
+	_os := codec.NewBuffer()
+	err = _os.Write_string(Hash, 1)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_int32(ActionOrdinal, 2)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Kind, 3)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Symbol, 4)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Amount, 5)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_string(Addr, 6)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _os.Write_int32(Type, 7)
+	if err != nil {
+		return ret, err
+	}
+
+	var _status map[string]string
+	var _context map[string]string
+	if len(_opt) == 1 {
+		_context = _opt[0]
+	} else if len(_opt) == 2 {
+		_context = _opt[0]
+		_status = _opt[1]
+	}
+	_resp := new(requestf.ResponsePacket)
+	err = _obj.s.Tars_invoke(ctx, 0, "revert_dc", _os.ToBytes(), _status, _context, _resp)
+	if err != nil {
+		return ret, err
+	}
+	_is := codec.NewReader(tools.Int8ToByte(_resp.SBuffer))
+	err = _is.Read_bool(&ret, 0, true)
+	if err != nil {
+		return ret, err
+	}
+
+	err = _is.Read_string(&(*Rsp), 8, true)
+	if err != nil {
+		return ret, err
+	}
+
+	_obj.setMap(len(_opt), _resp, _context, _status)
+	_ = length
+	_ = have
+	_ = ty
+	return ret, nil
+}
+
 //SetServant sets servant for the service.
 func (_obj *FreezingSys) SetServant(s m.Servant) {
 	_obj.s = s
@@ -397,11 +758,17 @@ type _impFreezingSys interface {
 	User_into_dc2(Addr string, Symbol string, Hash string, Amount string, Type int32) (ret bool, err error)
 	Commit_withdraw_dc(Hash string, Symbol string, Amount string, MinerCost string, Rsp *string) (ret bool, err error)
 	Insert_innerexchange_fee(Hash string, MinerCost string, Rsp *string) (ret bool, err error)
+	User_into_dc3(Info *DepositInfo, Rsp *string) (ret bool, err error)
+	Withdraw_failed_dc(Hash string, Symbol string, Amount string, Status string, Reason string, Rsp *string) (ret bool, err error)
+	Revert_dc(Hash string, ActionOrdinal int32, Kind string, Symbol string, Amount string, Addr string, Type int32, Rsp *string) (ret bool, err error)
 }
 type _impFreezingSysWithContext interface {
 	User_into_dc2(ctx context.Context, Addr string, Symbol string, Hash string, Amount string, Type int32) (ret bool, err error)
 	Commit_withdraw_dc(ctx context.Context, Hash string, Symbol string, Amount string, MinerCost string, Rsp *string) (ret bool, err error)
 	Insert_innerexchange_fee(ctx context.Context, Hash string, MinerCost string, Rsp *string) (ret bool, err error)
+	User_into_dc3(ctx context.Context, Info *DepositInfo, Rsp *string) (ret bool, err error)
+	Withdraw_failed_dc(ctx context.Context, Hash string, Symbol string, Amount string, Status string, Reason string, Rsp *string) (ret bool, err error)
+	Revert_dc(ctx context.Context, Hash string, ActionOrdinal int32, Kind string, Symbol string, Amount string, Addr string, Type int32, Rsp *string) (ret bool, err error)
 }
 
 func user_into_dc2(ctx context.Context, _val interface{}, _os *codec.Buffer, _is *codec.Reader, withContext bool) (err error) {
@@ -570,6 +937,188 @@ func insert_innerexchange_fee(ctx context.Context, _val interface{}, _os *codec.
 	_ = ty
 	return nil
 }
+func user_into_dc3(ctx context.Context, _val interface{}, _os *codec.Buffer, _is *codec.Reader, withContext bool) (err error) {
+	var length int32
+	var have bool
+	var ty byte
+	var Info DepositInfo
+	err = Info.ReadBlock(_is, 1, true)
+	if err != nil {
+		return err
+	}
+	var Rsp string
+	if withContext == false {
+		_imp := _val.(_impFreezingSys)
+		ret, err := _imp.User_into_dc3(&Info, &Rsp)
+		if err != nil {
+			return err
+		}
+
+		err = _os.Write_bool(ret, 0)
+		if err != nil {
+			return err
+		}
+	} else {
+		_imp := _val.(_impFreezingSysWithContext)
+		ret, err := _imp.User_into_dc3(ctx, &Info, &Rsp)
+		if err != nil {
+			return err
+		}
+
+		err = _os.Write_bool(ret, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = _os.Write_string(Rsp, 2)
+	if err != nil {
+		return err
+	}
+
+	_ = length
+	_ = have
+	_ = ty
+	return nil
+}
+func withdraw_failed_dc(ctx context.Context, _val interface{}, _os *codec.Buffer, _is *codec.Reader, withContext bool) (err error) {
+	var length int32
+	var have bool
+	var ty byte
+	var Hash string
+	err = _is.Read_string(&Hash, 1, true)
+	if err != nil {
+		return err
+	}
+	var Symbol string
+	err = _is.Read_string(&Symbol, 2, true)
+	if err != nil {
+		return err
+	}
+	var Amount string
+	err = _is.Read_string(&Amount, 3, true)
+	if err != nil {
+		return err
+	}
+	var Status string
+	err = _is.Read_string(&Status, 4, true)
+	if err != nil {
+		return err
+	}
+	var Reason string
+	err = _is.Read_string(&Reason, 5, true)
+	if err != nil {
+		return err
+	}
+	var Rsp string
+	if withContext == false {
+		_imp := _val.(_impFreezingSys)
+		ret, err := _imp.Withdraw_failed_dc(Hash, Symbol, Amount, Status, Reason, &Rsp)
+		if err != nil {
+			return err
+		}
+
+		err = _os.Write_bool(ret, 0)
+		if err != nil {
+			return err
+		}
+	} else {
+		_imp := _val.(_impFreezingSysWithContext)
+		ret, err := _imp.Withdraw_failed_dc(ctx, Hash, Symbol, Amount, Status, Reason, &Rsp)
+		if err != nil {
+			return err
+		}
+
+		err = _os.Write_bool(ret, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = _os.Write_string(Rsp, 6)
+	if err != nil {
+		return err
+	}
+
+	_ = length
+	_ = have
+	_ = ty
+	return nil
+}
+func revert_dc(ctx context.Context, _val interface{}, _os *codec.Buffer, _is *codec.Reader, withContext bool) (err error) {
+	var length int32
+	var have bool
+	var ty byte
+	var Hash string
+	err = _is.Read_string(&Hash, 1, true)
+	if err != nil {
+		return err
+	}
+	var ActionOrdinal int32
+	err = _is.Read_int32(&ActionOrdinal, 2, true)
+	if err != nil {
+		return err
+	}
+	var Kind string
+	err = _is.Read_string(&Kind, 3, true)
+	if err != nil {
+		return err
+	}
+	var Symbol string
+	err = _is.Read_string(&Symbol, 4, true)
+	if err != nil {
+		return err
+	}
+	var Amount string
+	err = _is.Read_string(&Amount, 5, true)
+	if err != nil {
+		return err
+	}
+	var Addr string
+	err = _is.Read_string(&Addr, 6, true)
+	if err != nil {
+		return err
+	}
+	var Type int32
+	err = _is.Read_int32(&Type, 7, true)
+	if err != nil {
+		return err
+	}
+	var Rsp string
+	if withContext == false {
+		_imp := _val.(_impFreezingSys)
+		ret, err := _imp.Revert_dc(Hash, ActionOrdinal, Kind, Symbol, Amount, Addr, Type, &Rsp)
+		if err != nil {
+			return err
+		}
+
+		err = _os.Write_bool(ret, 0)
+		if err != nil {
+			return err
+		}
+	} else {
+		_imp := _val.(_impFreezingSysWithContext)
+		ret, err := _imp.Revert_dc(ctx, Hash, ActionOrdinal, Kind, Symbol, Amount, Addr, Type, &Rsp)
+		if err != nil {
+			return err
+		}
+
+		err = _os.Write_bool(ret, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = _os.Write_string(Rsp, 8)
+	if err != nil {
+		return err
+	}
+
+	_ = length
+	_ = have
+	_ = ty
+	return nil
+}
 
 //Dispatch is used to call the server side implemnet for the method defined in the tars file. withContext shows using context or not.
 func (_obj *FreezingSys) Dispatch(ctx context.Context, _val interface{}, req *requestf.RequestPacket, resp *requestf.ResponsePacket, withContext bool) (err error) {
@@ -591,6 +1140,21 @@ func (_obj *FreezingSys) Dispatch(ctx context.Context, _val interface{}, req *re
 		if err != nil {
 			return err
 		}
+	case "user_into_dc3":
+		err := user_into_dc3(ctx, _val, _os, _is, withContext)
+		if err != nil {
+			return err
+		}
+	case "withdraw_failed_dc":
+		err := withdraw_failed_dc(ctx, _val, _os, _is, withContext)
+		if err != nil {
+			return err
+		}
+	case "revert_dc":
+		err := revert_dc(ctx, _val, _os, _is, withContext)
+		if err != nil {
+			return err
+		}
 
 	default:
 		return fmt.Errorf("func mismatch")
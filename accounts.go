@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/speps/go-hashids"
+	"gopkg.in/ini.v1"
+)
+
+const (
+	MEMO_SCHEME_HASHIDS = "hashids"
+	MEMO_SCHEME_UID     = "uid"
+)
+
+const defaultMemoSalt = "mohu@2020"
+
+// WatchedAccount is an account whose transfers are reported, with the
+// settings of the deposits it receives.
+type WatchedAccount struct {
+	Name string
+
+	MemoScheme string
+	MemoSalt   string
+
+	RegistryAddr string
+	ChainId      int
+	// sinks of its events, [sinks] enabled when nil
+	Sinks []string
+	// smallest deposit credited in token units, the min_deposit of the
+	// token when nil
+	MinDeposit *big.Rat
+	// first action history position to read without a saved cursor
+	ActionPos int64
+}
+
+// loadWatchedAccount reads the settings of an account from its
+// section, the missing keys are taken from base.
+func loadWatchedAccount(section *ini.Section, name string, base *WatchedAccount) (*WatchedAccount, error) {
+	account := &WatchedAccount{
+		Name:         name,
+		MemoScheme:   section.Key("memo").MustString(base.MemoScheme),
+		MemoSalt:     section.Key("memo_salt").MustString(base.MemoSalt),
+		RegistryAddr: section.Key("registry").MustString(base.RegistryAddr),
+		ChainId:      section.Key("chain_id").MustInt(base.ChainId),
+		ActionPos:    section.Key("action_pos").MustInt64(base.ActionPos),
+	}
+
+	if account.MemoScheme != MEMO_SCHEME_HASHIDS && account.MemoScheme != MEMO_SCHEME_UID {
+		return nil, fmt.Errorf("unknown memo scheme of %s: %s", name, account.MemoScheme)
+	}
+	if section.HasKey("sinks") {
+		account.Sinks = section.Key("sinks").Strings(",")
+	}
+	if section.HasKey("min_deposit") {
+		minDeposit, ok := new(big.Rat).SetString(section.Key("min_deposit").String())
+		if !ok || minDeposit.Sign() < 0 {
+			return nil, fmt.Errorf("invalid min_deposit of %s: %s", name, section.Key("min_deposit").String())
+		}
+		account.MinDeposit = minDeposit
+	}
+	return account, nil
+}
+
+// DepositMinimum returns the smallest deposit of the token credited to
+// the account, in units of the token.
+func (a *WatchedAccount) DepositMinimum(t *Token) *big.Int {
+	if a.MinDeposit == nil {
+		return t.MinDeposit
+	}
+	units := new(big.Rat).Mul(a.MinDeposit, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(t.Precision)), nil)))
+	minimum, rem := new(big.Int).QuoRem(units.Num(), units.Denom(), new(big.Int))
+	if rem.Sign() > 0 {
+		minimum.Add(minimum, big.NewInt(1))
+	}
+	return minimum
+}
+
+// Watched returns the watched account of that name, nil if there is none.
+func (c *Config) Watched(name string) *WatchedAccount {
+	for _, account := range c.Accounts {
+		if account.Name == name {
+			return account
+		}
+	}
+	return nil
+}
+
+// AccountSinks returns the sinks of the events of an account.
+func (c *Config) AccountSinks(name string) []string {
+	if account := c.Watched(name); account != nil && account.Sinks != nil {
+		return account.Sinks
+	}
+	return c.Sinks
+}
+
+// EnabledSinks returns every sink an account sends its events to.
+func (c *Config) EnabledSinks() []string {
+	sinks := append([]string(nil), c.Sinks...)
+	for _, account := range c.Accounts {
+		for _, name := range account.Sinks {
+			found := false
+			for _, sink := range sinks {
+				found = found || sink == name
+			}
+			if !found {
+				sinks = append(sinks, name)
+			}
+		}
+	}
+	return sinks
+}
+
+func memoHashID(salt string) *hashids.HashID {
+	hd := hashids.NewData()
+	hd.Salt = salt
+	hd.Alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ23456789"
+	hd.MinLength = 5
+
+	h, _ := hashids.NewWithData(hd)
+	return h
+}
+
+func CreateMemoByUID(account *WatchedAccount, uid uint64) string {
+	if account.MemoScheme == MEMO_SCHEME_UID {
+		return strconv.FormatUint(uid, 10)
+	}
+
+	newID, _ := memoHashID(account.MemoSalt).EncodeHex(strconv.FormatUint(uid, 16))
+	return newID
+}
+
+func ParseMemoToUID(account *WatchedAccount, memo string) (uid uint64, err error) {
+	if account.MemoScheme == MEMO_SCHEME_UID {
+		return strconv.ParseUint(strings.TrimSpace(memo), 10, 64)
+	}
+
+	d, err := memoHashID(account.MemoSalt).DecodeHex(memo)
+	if err != nil {
+		return
+	}
+	uid, err = strconv.ParseUint(d, 16, 64)
+	return
+}
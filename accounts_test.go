@@ -0,0 +1,142 @@
+package main
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testAccountsConfig = `
+[network]
+rpc_host = http://127.0.0.1:8888
+chain_id = 3
+
+[account]
+name = wallet
+
+[extapi]
+registry = 10.0.0.1
+lastAction = 7
+
+[token.USDT]
+contract = tethertether
+precision = 4
+min_deposit = 1.5
+
+[watch.exchange]
+memo = uid
+registry = 10.0.0.2
+chain_id = 5
+min_deposit = 0.00005
+sinks = jsonl
+
+[sink.jsonl]
+path = events.jsonl
+`
+
+func TestLoadWatchedAccounts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "wallet.ini")
+	if err = ioutil.WriteFile(path, []byte(testAccountsConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfiguration(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(config.Accounts) != 2 {
+		t.Fatalf("got %d accounts, want 2", len(config.Accounts))
+	}
+	wallet, exchange := config.Watched("wallet"), config.Watched("exchange")
+	if wallet.MemoScheme != MEMO_SCHEME_HASHIDS || wallet.RegistryAddr != "10.0.0.1" || wallet.ActionPos != 7 {
+		t.Errorf("unexpected wallet account %+v", wallet)
+	}
+	if exchange.MemoScheme != MEMO_SCHEME_UID || exchange.RegistryAddr != "10.0.0.2" || exchange.ChainId != 5 || exchange.ActionPos != 0 {
+		t.Errorf("unexpected exchange account %+v", exchange)
+	}
+
+	if usdt := config.Token("tethertether", "USDT"); usdt == nil || usdt.MinDeposit.Int64() != 15000 || config.TokenBySymbol("EOS").MinDeposit.Int64() != 1000 {
+		t.Errorf("unexpected tokens %+v", config.Tokens)
+	}
+	if sinks := config.AccountSinks("exchange"); len(sinks) != 1 || sinks[0] != SINK_JSONL {
+		t.Errorf("unexpected sinks of exchange %v", sinks)
+	}
+	if sinks := config.EnabledSinks(); len(sinks) != 2 || config.AccountSinks("wallet")[0] != SINK_TARS {
+		t.Errorf("unexpected sinks %v", sinks)
+	}
+	// the deposits of one transaction are told apart by their ordinal
+	if config.DepositMethod != DEPOSIT_METHOD_DC3 {
+		t.Errorf("deposit method is %s, want %s", config.DepositMethod, DEPOSIT_METHOD_DC3)
+	}
+
+	// the minimum of the account overrides the one of the token
+	if wallet.DepositMinimum(config.TokenBySymbol("EOS")).Int64() != 1000 || exchange.DepositMinimum(config.TokenBySymbol("USDT")).Int64() != 1 {
+		t.Errorf("unexpected deposit minimums of %+v", config.Tokens)
+	}
+	if config.Token("fakeeostoken", "EOS") != nil {
+		t.Error("unexpected token registry")
+	}
+
+	for _, account := range config.Accounts {
+		uid, err := ParseMemoToUID(account, CreateMemoByUID(account, 12345))
+		if err != nil || uid != 12345 {
+			t.Errorf("%s: memo round trip gave %d, err %v", account.Name, uid, err)
+		}
+	}
+
+	// both sides of a transfer between watched accounts are handled
+	message := &NotifyMessage{AddressFrom: "wallet", AddressTo: "exchange"}
+	if parties := WatchedParties(config, message); len(parties) != 2 {
+		t.Errorf("got %d parties, want 2", len(parties))
+	}
+	message.Receiver = "exchange"
+	if parties := WatchedParties(config, message); len(parties) != 1 || parties[0] != exchange {
+		t.Errorf("unexpected parties %+v", parties)
+	}
+}
+
+// TestAccountSinks checks that the events of an account only go to its
+// own sinks.
+func TestAccountSinks(t *testing.T) {
+	store, cleanup := openTestStore(t)
+	defer cleanup()
+
+	config := &Config{
+		Accounts: []*WatchedAccount{{Name: "wallet", MemoScheme: MEMO_SCHEME_UID}, {Name: "exchange", MemoScheme: MEMO_SCHEME_UID, Sinks: []string{"other"}}},
+		Tokens:   []*Token{EOSToken()},
+		Sinks:    []string{"test"},
+	}
+	for _, to := range []string{"wallet", "exchange"} {
+		message := &NotifyMessage{
+			MessageType: NOTIFY_TYPE_TX,
+			AddressFrom: "alice",
+			AddressTo:   to,
+			Contract:    "eosio.token",
+			Symbol:      "EOS",
+			Precision:   4,
+			Amount:      big.NewInt(10000),
+			Memo:        "42",
+			TxHash:      "aa" + to,
+			Ordinal:     1,
+		}
+		HandleTransfer(config, store, nil, message)
+	}
+
+	entries, _ := store.OutboxEntries(false)
+	if len(entries) != 2 {
+		t.Fatalf("unexpected outbox %+v", entries)
+	}
+	for _, entry := range entries {
+		if (entry.Account == "wallet") != (entry.Sink == "test") {
+			t.Errorf("event of %s queued for %s", entry.Account, entry.Sink)
+		}
+	}
+}
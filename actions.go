@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/eoscanada/eos-go"
+	"github.com/eoscanada/eos-go/token"
+)
+
+const actionPageSize = 100
+
+// HistoryAction is an action delivered to an account, as recorded by a
+// history service. Pos is the position of the action in the history of
+// the account, Receiver the account the notification was delivered to.
+type HistoryAction struct {
+	Pos       int64
+	BlockNum  uint32
+	BlockTime int64
+	TxID      string
+	// action_ordinal of the execution by the contract
+	Ordinal  uint32
+	Receiver string
+	Account  string
+	Name     string
+	Transfer *token.Transfer
+	// resources billed to the transaction, when the service has them
+	CPUUsage uint32
+	NetUsage uint32
+}
+
+// ActionHistory lists the actions, inline ones included, delivered to
+// an account.
+type ActionHistory interface {
+	Actions(account string, pos int64, limit int) ([]HistoryAction, error)
+}
+
+func NewActionHistory(config *Config) (ActionHistory, error) {
+	switch config.HistoryAPI {
+	case "", "nodeos":
+		api := eos.New(config.HistoryURL)
+		api.HttpClient = NewHTTPClient(config.RPCTimeout)
+		return &NodeosHistory{api: api}, nil
+	case "hyperion":
+		return &HyperionHistory{
+			url:    strings.TrimRight(config.HistoryURL, "/"),
+			client: NewHTTPClient(config.RPCTimeout),
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown history api: %s", config.HistoryAPI)
+}
+
+// decodeTransfer reads the data of a transfer action whatever the
+// history service made of it.
+func decodeTransfer(data interface{}) (*token.Transfer, error) {
+	if transfer, ok := data.(*token.Transfer); ok {
+		return transfer, nil
+	}
+
+	var raw []byte
+	var err error
+	if msg, ok := data.(json.RawMessage); ok {
+		raw = msg
+	} else if raw, err = json.Marshal(data); err != nil {
+		return nil, err
+	}
+
+	transfer := new(token.Transfer)
+	if err = json.Unmarshal(raw, transfer); err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// NodeosHistory reads /v1/history/get_actions of the nodeos history
+// plugin, where pos is the account_action_seq.
+type NodeosHistory struct {
+	api *eos.API
+}
+
+func (h *NodeosHistory) Actions(account string, pos int64, limit int) ([]HistoryAction, error) {
+	rsp, err := h.api.GetActions(eos.GetActionsRequest{
+		AccountName: eos.AccountName(account),
+		Pos:         eos.Int64(pos),
+		Offset:      eos.Int64(limit - 1),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var actions []HistoryAction
+	txTraces := make(map[string][]eos.ActionTrace)
+	for _, item := range rsp.Actions {
+		trace := item.Trace
+		action := HistoryAction{
+			Pos:       int64(item.AccountSeq),
+			BlockNum:  item.BlockNum,
+			BlockTime: item.BlockTime.Unix(),
+			TxID:      trace.TransactionID.String(),
+			Receiver:  string(trace.Receiver),
+			Ordinal:   trace.ActionOrdinal,
+		}
+		if trace.Receipt != nil {
+			action.Receiver = string(trace.Receipt.Receiver)
+		}
+		if trace.Action != nil {
+			action.Account = string(trace.Action.Account)
+			if action.Receiver != action.Account {
+				traces, ok := txTraces[action.TxID]
+				if !ok {
+					if traces, err = h.transactionTraces(action.TxID); err != nil {
+						return nil, err
+					}
+					txTraces[action.TxID] = traces
+				}
+				action.Ordinal = historyOrdinal(traces, trace)
+			}
+			action.Name = string(trace.Action.Name)
+			if action.Name == "transfer" {
+				action.Transfer, err = decodeTransfer(trace.Action.ActionData.Data)
+				if err != nil {
+					log.Println("decode transfer of", action.TxID, "err:", err)
+				}
+			}
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+// transactionTraces returns every action trace of a transaction, the
+// inline ones of older history plugins flattened.
+func (h *NodeosHistory) transactionTraces(id string) ([]eos.ActionTrace, error) {
+	rsp, err := h.api.GetTransaction(id)
+	if err != nil {
+		return nil, fmt.Errorf("get_transaction %s: %v", id, err)
+	}
+
+	var traces []eos.ActionTrace
+	var flatten func([]eos.ActionTrace)
+	flatten = func(list []eos.ActionTrace) {
+		for _, trace := range list {
+			traces = append(traces, trace)
+			flatten(trace.InlineTraces)
+		}
+	}
+	flatten(rsp.Traces)
+	return traces, nil
+}
+
+func actionData(action *eos.Action) []byte {
+	if len(action.HexData) > 0 {
+		return action.HexData
+	}
+	data, _ := json.Marshal(action.Data)
+	return data
+}
+
+// historyOrdinal returns the ordinal of the action execution a
+// notification belongs to, the execution by the contract with the same
+// creator and data, as originalOrdinal does for the state history.
+func historyOrdinal(traces []eos.ActionTrace, notification eos.ActionTrace) uint32 {
+	action := notification.Action
+	for _, other := range traces {
+		if other.Action == nil || other.Receiver != other.Action.Account {
+			continue
+		}
+		if other.Action.Account == action.Account && other.Action.Name == action.Name &&
+			other.CreatorActionOrdinal == notification.CreatorActionOrdinal &&
+			bytes.Equal(actionData(other.Action), actionData(action)) {
+			return other.ActionOrdinal
+		}
+	}
+	return notification.ActionOrdinal
+}
+
+// HyperionHistory reads /v2/history/get_actions of a Hyperion
+// service, where pos is the number of actions skipped in ascending
+// order.
+type HyperionHistory struct {
+	url    string
+	client *http.Client
+}
+
+type hyperionAction struct {
+	BlockNum      uint32             `json:"block_num"`
+	Timestamp     eos.BlockTimestamp `json:"timestamp"`
+	TrxID         string             `json:"trx_id"`
+	ActionOrdinal uint32             `json:"action_ordinal"`
+	Act           struct {
+		Account string          `json:"account"`
+		Name    string          `json:"name"`
+		Data    json.RawMessage `json:"data"`
+	} `json:"act"`
+	Notified      []string `json:"notified"`
+	CPUUsageUs    uint32   `json:"cpu_usage_us"`
+	NetUsageWords uint32   `json:"net_usage_words"`
+}
+
+type hyperionActionsResp struct {
+	Actions []hyperionAction `json:"actions"`
+}
+
+func (h *HyperionHistory) Actions(account string, pos int64, limit int) ([]HistoryAction, error) {
+	query := url.Values{}
+	query.Set("account", account)
+	query.Set("sort", "asc")
+	query.Set("skip", strconv.FormatInt(pos, 10))
+	query.Set("limit", strconv.Itoa(limit))
+
+	rsp, err := h.client.Get(h.url + "/v2/history/get_actions?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get_actions: status code=%d, body=%s", rsp.StatusCode, body)
+	}
+
+	var out hyperionActionsResp
+	if err = json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("get_actions: %v", err)
+	}
+
+	var actions []HistoryAction
+	for i, item := range out.Actions {
+		action := HistoryAction{
+			Pos:       pos + int64(i),
+			BlockNum:  item.BlockNum,
+			BlockTime: item.Timestamp.Unix(),
+			TxID:      item.TrxID,
+			Ordinal:   item.ActionOrdinal,
+			Account:   item.Act.Account,
+			Name:      item.Act.Name,
+			CPUUsage:  item.CPUUsageUs,
+			NetUsage:  item.NetUsageWords,
+		}
+		// one document per action, listing every notified account
+		for _, notified := range item.Notified {
+			if notified == account {
+				action.Receiver = account
+			}
+		}
+		if action.Name == "transfer" {
+			action.Transfer, err = decodeTransfer(item.Act.Data)
+			if err != nil {
+				log.Println("decode transfer of", action.TxID, "err:", err)
+			}
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+// ActionScanner walks the action history of a watched account and
+// reports the transfers delivered to it once they are final.
+type ActionScanner struct {
+	config  *Config
+	account string
+	history ActionHistory
+	notify  chan<- NotifyMessage
+	next    int64
+	// first position not yet reported as pending
+	pendingPos int64
+}
+
+func NewActionScanner(config *Config, account string, history ActionHistory, notify chan<- NotifyMessage, next int64) *ActionScanner {
+	return &ActionScanner{
+		config:     config,
+		account:    account,
+		history:    history,
+		notify:     notify,
+		next:       next,
+		pendingPos: next,
+	}
+}
+
+func (s *ActionScanner) Next() int64 {
+	return s.next
+}
+
+// Scan delivers the transfers of the actions up to the final block, it
+// returns false if the history could not be read.
+func (s *ActionScanner) Scan(head uint64, lib uint64) bool {
+	confirmed := ConfirmedHeight(s.config, head, lib)
+
+	pos := s.next
+	for {
+		actions, err := s.history.Actions(s.account, pos, actionPageSize)
+		if err != nil {
+			log.Println("ActionListener:", err)
+			return false
+		}
+
+		for _, action := range actions {
+			msg, ok := s.transferMessage(action)
+			if uint64(action.BlockNum) > confirmed {
+				if s.config.ConfirmPolicy != CONFIRM_INSTANT {
+					return true
+				}
+				if ok && action.Pos >= s.pendingPos {
+					msg.MessageType = NOTIFY_TYPE_PENDING
+					s.notify <- msg
+				}
+				if action.Pos >= s.pendingPos {
+					s.pendingPos = action.Pos + 1
+				}
+				continue
+			}
+
+			if ok {
+				s.notify <- msg
+			}
+			if action.Pos >= s.next {
+				s.next = action.Pos + 1
+				s.notify <- NotifyMessage{
+					MessageType: NOTIFY_TYPE_ADMIN,
+					Amount:      new(big.Int).SetUint64(uint64(action.BlockNum)),
+					BlockTime:   action.BlockTime,
+					Cursor:      &Cursor{Number: uint64(action.BlockNum), ActionPos: s.next, Account: s.account},
+				}
+			}
+		}
+
+		if len(actions) < actionPageSize {
+			return true
+		}
+		pos = actions[len(actions)-1].Pos + 1
+	}
+}
+
+func (s *ActionScanner) transferMessage(action HistoryAction) (NotifyMessage, bool) {
+	if action.Receiver != s.account || action.Name != "transfer" {
+		return NotifyMessage{}, false
+	}
+	msg, ok := ParseTransfer(action.Transfer, action.Account, action.TxID, action.BlockTime)
+	msg.Receiver = s.account
+	msg.BlockNum = uint64(action.BlockNum)
+	msg.Ordinal = action.Ordinal
+	msg.CPUUsage = action.CPUUsage
+	msg.NetUsage = action.NetUsage
+	return msg, ok
+}
+
+// ActionListener scans the action history of every watched account,
+// positions holds the next position of each one. The accounts scanned
+// up to the final block get its time from clock.
+func ActionListener(config *Config, history ActionHistory, clock *BroadcastClock, ch <-chan ObjMessage, notifyChannel chan<- NotifyMessage, positions map[string]int64) {
+	var scanners []*ActionScanner
+	for _, account := range config.Accounts {
+		scanners = append(scanners, NewActionScanner(config, account.Name, history, notifyChannel, positions[account.Name]))
+	}
+
+	for message := range ch {
+		switch message.Type {
+		case TYPE_BLOCK_HASH:
+			head, lib := message.Number.Uint64(), message.Irreversible.Uint64()
+			var scanned []string
+			for _, scanner := range scanners {
+				if scanner.Scan(head, lib) {
+					scanned = append(scanned, scanner.account)
+				}
+			}
+
+			confirmed := ConfirmedHeight(config, head, lib)
+			if blockTime, ok := clock.BlockTime(confirmed, message.Time); ok {
+				for _, account := range scanned {
+					notifyChannel <- NotifyMessage{MessageType: NOTIFY_TYPE_CLOCK, Receiver: account, BlockNum: confirmed, BlockTime: blockTime}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type testAction struct {
+	blockNum uint32
+	contract string
+	from     string
+	to       string
+	quantity string
+	memo     string
+}
+
+// txOrdinal returns the action_ordinal of the i-th action in its
+// transaction, every action of a block is one transaction of top-level
+// transfers, and the number of actions in it.
+func txOrdinal(actions []testAction, i int) (uint32, uint32) {
+	var k, n uint32
+	for j, a := range actions {
+		if a.blockNum == actions[i].blockNum {
+			n++
+			if j <= i {
+				k++
+			}
+		}
+	}
+	return k, n
+}
+
+func testTrxID(a testAction) string {
+	return fmt.Sprintf("%064x", a.blockNum)
+}
+
+func testTransferData(a testAction) map[string]interface{} {
+	return map[string]interface{}{
+		"from":     a.from,
+		"to":       a.to,
+		"quantity": a.quantity,
+		"memo":     a.memo,
+	}
+}
+
+// testTrace is the trace of a transfer executed by receiver, the
+// notifications follow the executions by the contract in the ordinals.
+func testTrace(a testAction, receiver string, ordinal uint32) map[string]interface{} {
+	return map[string]interface{}{
+		"receipt": map[string]interface{}{
+			"receiver":      receiver,
+			"auth_sequence": [][]interface{}{{a.from, 1}},
+		},
+		"receiver": receiver,
+		"act": map[string]interface{}{
+			"account": a.contract,
+			"name":    "transfer",
+			"data":    testTransferData(a),
+		},
+		"trx_id":                 testTrxID(a),
+		"block_num":              a.blockNum,
+		"action_ordinal":         ordinal,
+		"creator_action_ordinal": 0,
+		"closest_unnotified_ancestor_action_ordinal": 0,
+	}
+}
+
+// newHistoryServer serves the actions delivered to wallet in the shape
+// of both the nodeos history plugin and Hyperion.
+func newHistoryServer(t *testing.T, actions []testAction) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/history/get_actions", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			AccountName string `json:"account_name"`
+			Pos         int64  `json:"pos"`
+			Offset      int64  `json:"offset"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		var out []map[string]interface{}
+		for i := req.Pos; i < int64(len(actions)) && i <= req.Pos+req.Offset; i++ {
+			a := actions[i]
+			k, n := txOrdinal(actions, int(i))
+			out = append(out, map[string]interface{}{
+				"global_action_seq":  1000 + i,
+				"account_action_seq": i,
+				"block_num":          a.blockNum,
+				"block_time":         "2020-06-01T00:00:00.000",
+				"action_trace":       testTrace(a, req.AccountName, n+2*k),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"actions": out})
+	})
+	mux.HandleFunc("/v1/history/get_transaction", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID string `json:"id"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		var traces []map[string]interface{}
+		for i, a := range actions {
+			if testTrxID(a) != req.ID {
+				continue
+			}
+			k, n := txOrdinal(actions, i)
+			traces = append(traces,
+				testTrace(a, a.contract, k),
+				testTrace(a, a.from, n+2*k-1),
+				testTrace(a, a.to, n+2*k))
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": req.ID, "traces": traces})
+	})
+	mux.HandleFunc("/v2/history/get_actions", func(w http.ResponseWriter, r *http.Request) {
+		skip, _ := strconv.Atoi(r.URL.Query().Get("skip"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		account := r.URL.Query().Get("account")
+
+		out := []map[string]interface{}{}
+		for i := skip; i < len(actions) && i < skip+limit; i++ {
+			a := actions[i]
+			k, _ := txOrdinal(actions, i)
+			data := testTransferData(a)
+			data["amount"] = 1
+			data["symbol"] = strings.Fields(a.quantity)[1]
+			out = append(out, map[string]interface{}{
+				"timestamp":      "2020-06-01T00:00:00.000",
+				"block_num":      a.blockNum,
+				"trx_id":         testTrxID(a),
+				"action_ordinal": k,
+				"act": map[string]interface{}{
+					"account": a.contract,
+					"name":    "transfer",
+					"data":    data,
+				},
+				"notified": []string{a.contract, a.from, account},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"actions": out})
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestActionScanner(t *testing.T) {
+	actions := []testAction{
+		{10, "eosio.token", "dexcontract", "wallet", "1.0000 EOS", "inline"},
+		{11, "fakeeostoken", "alice", "wallet", "5.0000 EOS", "fake"},
+		{20, "eosio.token", "alice", "wallet", "2.0000 EOS", "later"},
+	}
+	server := newHistoryServer(t, actions)
+	defer server.Close()
+
+	for _, api := range []string{"nodeos", "hyperion"} {
+		config := &Config{Account: "wallet", Tokens: []*Token{EOSToken()}, HistoryAPI: api, HistoryURL: server.URL}
+		history, err := NewActionHistory(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ch := make(chan NotifyMessage, 100)
+		scanner := NewActionScanner(config, "wallet", history, ch, 0)
+		scanner.Scan(30, 15)
+		msgs, cursor := drainCursor(ch)
+		if len(msgs) != 2 || msgs[0].Memo != "inline" || msgs[0].Amount.Int64() != 10000 {
+			t.Fatalf("%s: unexpected messages %+v", api, msgs)
+		}
+		// the fake token is left to the notifier
+		if _, rejected := CheckTransfer(config, &msgs[1]); rejected != SECURITY_COUNTERFEIT {
+			t.Errorf("%s: fake transfer %+v not rejected", api, msgs[1])
+		}
+		if scanner.Next() != 2 || cursor == nil || cursor.ActionPos != 2 {
+			t.Errorf("%s: next action is %d, want 2", api, scanner.Next())
+		}
+
+		scanner.Scan(30, 20)
+		msgs = drain(ch)
+		if len(msgs) != 1 || msgs[0].Memo != "later" {
+			t.Fatalf("%s: unexpected messages %+v", api, msgs)
+		}
+	}
+}
+
+// TestActionScannerSameTransaction checks that two transfers of one
+// transaction get the ordinals of their executions, as in a block.
+func TestActionScannerSameTransaction(t *testing.T) {
+	actions := []testAction{
+		{10, "eosio.token", "alice", "wallet", "1.0000 EOS", "42"},
+		{10, "eosio.token", "alice", "wallet", "2.0000 EOS", "43"},
+	}
+	server := newHistoryServer(t, actions)
+	defer server.Close()
+
+	for _, api := range []string{"nodeos", "hyperion"} {
+		store, cleanup := openTestStore(t)
+		config := &Config{Account: "wallet", Tokens: []*Token{EOSToken()}, HistoryAPI: api, HistoryURL: server.URL}
+		history, err := NewActionHistory(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ch := make(chan NotifyMessage, 100)
+		NewActionScanner(config, "wallet", history, ch, 0).Scan(30, 15)
+		msgs := drain(ch)
+		if len(msgs) != 2 || msgs[0].Ordinal != 1 || msgs[1].Ordinal != 2 || msgs[0].TxHash != msgs[1].TxHash {
+			t.Fatalf("%s: unexpected messages %+v", api, msgs)
+		}
+		for i := range msgs {
+			if store.Delivered("wallet", LEDGER_DEPOSIT, &msgs[i]) {
+				t.Errorf("%s: transfer %d taken as delivered", api, i)
+			}
+			if err := store.RecordDelivery("wallet", LEDGER_DEPOSIT, &msgs[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		cleanup()
+	}
+}
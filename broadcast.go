@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	BROADCAST_PENDING   = "pending"
+	BROADCAST_CONFIRMED = "confirmed"
+	BROADCAST_EXPIRED   = "expired"
+	BROADCAST_FAILED    = "failed"
+	// not pushed by this wallet, or not since the store was created
+	BROADCAST_UNKNOWN = "unknown"
+)
+
+// Broadcast is a transfer pushed by the wallet, followed until it is
+// confirmed or can no longer be.
+type Broadcast struct {
+	ID         string `json:"id"`
+	Account    string `json:"account"`
+	To         string `json:"to"`
+	Symbol     string `json:"symbol"`
+	Amount     string `json:"amount"`
+	Memo       string `json:"memo"`
+	Expiration int64  `json:"expiration"`
+	Created    int64  `json:"created"`
+	Status     string `json:"status"`
+	BlockNum   uint64 `json:"block_num,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// TrackBroadcast records a pushed transfer as pending, the pending ones
+// are also kept in an index of their own until they are resolved.
+func (s *Store) TrackBroadcast(b *Broadcast) error {
+	b.Status = BROADCAST_PENDING
+	b.Created = time.Now().Unix()
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(bucketBroadcasts).Put([]byte(b.ID), data); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketPending).Put([]byte(b.ID), data)
+	})
+}
+
+// indexPendingBroadcasts fills the pending index of a store made before
+// it existed.
+func indexPendingBroadcasts(tx *bolt.Tx) error {
+	pending := tx.Bucket(bucketPending)
+	return tx.Bucket(bucketBroadcasts).ForEach(func(k, v []byte) error {
+		var b Broadcast
+		if err := json.Unmarshal(v, &b); err != nil {
+			return err
+		}
+		if b.Status != BROADCAST_PENDING {
+			return nil
+		}
+		return pending.Put(k, v)
+	})
+}
+
+// Broadcast returns the broadcast of a transaction, nil if it is not
+// tracked.
+func (s *Store) Broadcast(id string) (*Broadcast, error) {
+	b := new(Broadcast)
+	found, err := s.get(bucketBroadcasts, []byte(id), b)
+	if err != nil || !found {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Broadcasts returns the broadcasts with that status, all of them if
+// it is empty. The pending ones are read from their index.
+func (s *Store) Broadcasts(status string) ([]Broadcast, error) {
+	bucket := bucketBroadcasts
+	if status == BROADCAST_PENDING {
+		bucket = bucketPending
+	}
+
+	broadcasts := []Broadcast{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(k, v []byte) error {
+			var b Broadcast
+			if err := json.Unmarshal(v, &b); err != nil {
+				return err
+			}
+			if status == "" || b.Status == status {
+				broadcasts = append(broadcasts, b)
+			}
+			return nil
+		})
+	})
+	return broadcasts, err
+}
+
+// resolveBroadcast records the end of a pending broadcast, a failure is
+// queued for the sinks in the same transaction.
+func (s *Store) resolveBroadcast(sinks []string, b *Broadcast) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if b.Status != BROADCAST_CONFIRMED {
+			entry := &OutboxEntry{
+				Kind:    OUTBOX_WITHDRAW_FAILED,
+				Account: b.Account,
+				Symbol:  b.Symbol,
+				Hash:    b.ID,
+				Addr:    b.To,
+				Amount:  b.Amount,
+				Status:  b.Status,
+				Reason:  b.Reason,
+				Created: time.Now().Unix(),
+			}
+			if err := enqueue(tx, sinks, entry); err != nil {
+				return err
+			}
+		}
+		if err := tx.Bucket(bucketPending).Delete([]byte(b.ID)); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketBroadcasts).Put([]byte(b.ID), data)
+	})
+}
+
+// EarliestExpiration returns the earliest expiration of the pending
+// broadcasts, false if there is none.
+func (s *Store) EarliestExpiration() (int64, bool, error) {
+	pending, err := s.Broadcasts(BROADCAST_PENDING)
+	if err != nil || len(pending) == 0 {
+		return 0, false, err
+	}
+	earliest := pending[0].Expiration
+	for _, b := range pending[1:] {
+		if b.Expiration < earliest {
+			earliest = b.Expiration
+		}
+	}
+	return earliest, true, nil
+}
+
+// TrackBroadcasts follows the broadcasts through the messages of the
+// notifier: a confirmed transfer confirms its transaction, a failed one
+// fails it, and the transactions still pending once the transfers up
+// to a block after their expiration are delivered have expired.
+func TrackBroadcasts(config *Config, store *Store, message *NotifyMessage) {
+	switch message.MessageType {
+	case NOTIFY_TYPE_TX, NOTIFY_TYPE_FAILED:
+		b, err := store.Broadcast(message.TxHash)
+		if err != nil {
+			log.Println("read broadcast err:", err)
+			return
+		}
+		if b == nil || b.Status != BROADCAST_PENDING {
+			return
+		}
+
+		b.BlockNum = message.BlockNum
+		if message.MessageType == NOTIFY_TYPE_TX {
+			b.Status = BROADCAST_CONFIRMED
+		} else {
+			b.Status = BROADCAST_FAILED
+			b.Reason = fmt.Sprintf("%s in block %d", message.Status, message.BlockNum)
+		}
+		log.Println("broadcast", b.ID, b.Status)
+		if err := store.resolveBroadcast(config.AccountSinks(b.Account), b); err != nil {
+			log.Println("record broadcast err:", err)
+		}
+
+	case NOTIFY_TYPE_CLOCK:
+		pending, err := store.Broadcasts(BROADCAST_PENDING)
+		if err != nil {
+			log.Println("read broadcasts err:", err)
+			return
+		}
+		for i := range pending {
+			b := &pending[i]
+			// a clock of the action scan only tells about its own account
+			if message.Receiver != "" && message.Receiver != b.Account {
+				continue
+			}
+			if b.Expiration >= message.BlockTime {
+				continue
+			}
+			b.Status = BROADCAST_EXPIRED
+			b.Reason = fmt.Sprintf("not in a block up to %d", message.BlockNum)
+			log.Println("broadcast", b.ID, "expired")
+			if err := store.resolveBroadcast(config.AccountSinks(b.Account), b); err != nil {
+				log.Println("record broadcast err:", err)
+			}
+		}
+	}
+}
+
+// BroadcastClock reads the time of a block for the action scan, which
+// has no block of its own, once a pending broadcast may have expired.
+type BroadcastClock struct {
+	source BlockSource
+	store  *Store
+}
+
+func NewBroadcastClock(source BlockSource, store *Store) *BroadcastClock {
+	return &BroadcastClock{source: source, store: store}
+}
+
+// BlockTime returns the time of block num, false while no pending
+// broadcast expired before the head time.
+func (c *BroadcastClock) BlockTime(num uint64, headTime int64) (int64, bool) {
+	if c == nil {
+		return 0, false
+	}
+	earliest, ok, err := c.store.EarliestExpiration()
+	if err != nil {
+		log.Println("read broadcasts err:", err)
+		return 0, false
+	}
+	if !ok || earliest >= headTime {
+		return 0, false
+	}
+
+	block, err := c.source.BlockByNum(uint32(num))
+	if err != nil {
+		log.Println("read block", num, "err:", err)
+		return 0, false
+	}
+	return block.Timestamp.Unix(), true
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestTrackBroadcasts(t *testing.T) {
+	store, cleanup := openTestStore(t)
+	defer cleanup()
+
+	config := &Config{Accounts: []*WatchedAccount{{Name: "wallet"}}, Sinks: []string{"test"}}
+	now := time.Now().Unix()
+	for _, id := range []string{"aa", "bb", "cc"} {
+		b := &Broadcast{ID: id, Account: "wallet", To: "bob", Symbol: "EOS", Amount: "1.0000", Expiration: now + 30}
+		if err := store.TrackBroadcast(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	TrackBroadcasts(config, store, &NotifyMessage{MessageType: NOTIFY_TYPE_TX, TxHash: "aa", BlockNum: 10})
+	TrackBroadcasts(config, store, &NotifyMessage{MessageType: NOTIFY_TYPE_FAILED, TxHash: "bb", BlockNum: 10, Status: "hard_fail"})
+	// a block before the expiration leaves it pending, as does the clock
+	// of another account
+	TrackBroadcasts(config, store, &NotifyMessage{MessageType: NOTIFY_TYPE_CLOCK, BlockNum: 10, BlockTime: now})
+	TrackBroadcasts(config, store, &NotifyMessage{MessageType: NOTIFY_TYPE_CLOCK, Receiver: "exchange", BlockNum: 80, BlockTime: now + 31})
+	if pending, _ := store.Broadcasts(BROADCAST_PENDING); len(pending) != 1 || pending[0].ID != "cc" {
+		t.Fatalf("unexpected pending broadcasts %+v", pending)
+	}
+	TrackBroadcasts(config, store, &NotifyMessage{MessageType: NOTIFY_TYPE_CLOCK, Receiver: "wallet", BlockNum: 80, BlockTime: now + 31})
+	if pending, _ := store.Broadcasts(BROADCAST_PENDING); len(pending) != 0 {
+		t.Fatalf("unexpected pending broadcasts %+v", pending)
+	}
+	// a confirmation after the expiry changes nothing
+	TrackBroadcasts(config, store, &NotifyMessage{MessageType: NOTIFY_TYPE_TX, TxHash: "cc", BlockNum: 81})
+
+	want := map[string]string{"aa": BROADCAST_CONFIRMED, "bb": BROADCAST_FAILED, "cc": BROADCAST_EXPIRED}
+	all, err := store.Broadcasts("")
+	if err != nil || len(all) != 3 {
+		t.Fatalf("got %d broadcasts, err %v", len(all), err)
+	}
+	for _, b := range all {
+		if b.Status != want[b.ID] {
+			t.Errorf("broadcast %s is %s, want %s", b.ID, b.Status, want[b.ID])
+		}
+	}
+
+	sink := &testSink{up: true}
+	NewOutbox(config, store, map[string]DepositSink{"test": sink}).Flush(time.Now())
+	if len(sink.calls) != 2 || sink.calls[0] != OUTBOX_WITHDRAW_FAILED+" bb" || sink.calls[1] != OUTBOX_WITHDRAW_FAILED+" cc" {
+		t.Fatalf("unexpected sink calls %v", sink.calls)
+	}
+}
+
+// TestBroadcastClock checks that the action scan of an idle account
+// still expires its broadcasts from the time of the final block.
+func TestBroadcastClock(t *testing.T) {
+	store, cleanup := openTestStore(t)
+	defer cleanup()
+
+	chain := newTestChain()
+	for num := uint32(1); num <= 20; num++ {
+		chain.add(num, 0)
+	}
+	server := newHistoryServer(t, nil)
+	defer server.Close()
+
+	config := &Config{Accounts: []*WatchedAccount{{Name: "wallet"}}, Tokens: []*Token{EOSToken()}, HistoryURL: server.URL}
+	history, err := NewActionHistory(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &Broadcast{ID: "aa", Account: "wallet", To: "bob", Symbol: "EOS", Amount: "1.0000", Expiration: 1600000010}
+	if err := store.TrackBroadcast(b); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := NewBroadcastClock(chain.source, store)
+	// nothing to read while the head is not past the expiration
+	if _, ok := clock.BlockTime(8, 1600000010); ok {
+		t.Fatal("block time read before any expiration")
+	}
+
+	ch := make(chan ObjMessage, 1)
+	notify := make(chan NotifyMessage, 10)
+	go ActionListener(config, history, clock, ch, notify, nil)
+	ch <- ObjMessage{TYPE_BLOCK_HASH, "", big.NewInt(20), big.NewInt(15), 1600000020}
+	close(ch)
+
+	select {
+	case msg := <-notify:
+		if msg.MessageType != NOTIFY_TYPE_CLOCK || msg.Receiver != "wallet" || msg.BlockNum != 15 || msg.BlockTime != 1600000015 {
+			t.Fatalf("unexpected message %+v", msg)
+		}
+		TrackBroadcasts(config, store, &msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no clock from the action scan")
+	}
+	if got, _ := store.Broadcast("aa"); got == nil || got.Status != BROADCAST_EXPIRED {
+		t.Fatalf("unexpected broadcast %+v", got)
+	}
+}
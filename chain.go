@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/eoscanada/eos-go"
+)
+
+// TransportError is a request which got no usable answer from the
+// endpoint: connection refused, timeout, proxy error page...
+type TransportError struct {
+	Endpoint string
+	Err      error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("transport error on %s: %v", e.Endpoint, e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// ChainError is a request the chain answered with an error, like an
+// unknown account or a transaction failing its checks. Err is
+// eos.ErrNotFound or an eos.APIError.
+type ChainError struct {
+	Endpoint string
+	Err      error
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("chain error on %s: %v", e.Endpoint, e.Err)
+}
+
+func (e *ChainError) Unwrap() error {
+	return e.Err
+}
+
+// ChainClient is the access to the chain API shared by the handlers,
+// the scanner and the signer. Reads are retried with backoff while no
+// endpoint can be reached, pushes are never retried.
+type ChainClient struct {
+	pool    *RPCPool
+	retries int
+	backoff time.Duration
+}
+
+func NewChainClient(config *Config) *ChainClient {
+	return &ChainClient{
+		pool:    NewRPCPool(config),
+		retries: config.RPCRetries,
+		backoff: config.RPCBackoff,
+	}
+}
+
+// NewHTTPClient returns a client keeping its connections alive, with
+// a deadline for each request.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   10 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 16,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}
+}
+
+func (c *ChainClient) Pool() *RPCPool {
+	return c.pool
+}
+
+func (c *ChainClient) read(name string, fn func(api *eos.API) error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = c.pool.Call(name, fn)
+		if _, ok := err.(*TransportError); !ok || attempt >= c.retries {
+			return err
+		}
+
+		delay := c.backoff << uint(attempt)
+		log.Println("rpc", name, "retry in", delay, "err:", err)
+		time.Sleep(delay)
+	}
+}
+
+func (c *ChainClient) GetInfo() (info *eos.InfoResp, err error) {
+	err = c.read("get_info", func(api *eos.API) (err error) {
+		info, err = api.GetInfo()
+		return
+	})
+	return
+}
+
+func (c *ChainClient) GetBlockByNum(num uint32) (block *eos.BlockResp, err error) {
+	err = c.read("get_block", func(api *eos.API) (err error) {
+		block, err = api.GetBlockByNum(num)
+		return
+	})
+	return
+}
+
+// GetTransaction needs the history plugin on the endpoint.
+func (c *ChainClient) GetTransaction(id string) (tx *eos.TransactionResp, err error) {
+	err = c.read("get_transaction", func(api *eos.API) (err error) {
+		tx, err = api.GetTransaction(id)
+		return
+	})
+	return
+}
+
+func (c *ChainClient) GetAccount(name string) (account *eos.AccountResp, err error) {
+	err = c.read("get_account", func(api *eos.API) (err error) {
+		account, err = api.GetAccount(eos.AccountName(name))
+		return
+	})
+	return
+}
+
+func (c *ChainClient) GetCurrencyBalance(account string, symbol string, code string) (balances []eos.Asset, err error) {
+	err = c.read("get_currency_balance", func(api *eos.API) (err error) {
+		balances, err = api.GetCurrencyBalance(eos.AccountName(account), symbol, eos.AccountName(code))
+		return
+	})
+	return
+}
+
+// SignPushActions signs the actions with the wallet key and pushes them.
+func (c *ChainClient) SignPushActions(actions []*eos.Action) (rsp *eos.PushTransactionFullResp, err error) {
+	err = c.pool.Send("push_transaction", func(api *eos.API) (err error) {
+		rsp, err = api.SignPushActionsWithOpts(actions, nil)
+		return
+	})
+	return
+}
+
+func (c *ChainClient) PushTransaction(packed *eos.PackedTransaction) (rsp *eos.PushTransactionFullResp, err error) {
+	err = c.pool.Send("push_transaction", func(api *eos.API) (err error) {
+		rsp, err = api.PushTransaction(packed)
+		return
+	})
+	return
+}
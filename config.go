@@ -1,8 +1,17 @@
 package main
 
 import (
+	"fmt"
 	"gopkg.in/ini.v1"
-	"strconv"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	CONFIRM_LIB = iota
+	CONFIRM_BLOCKS
+	CONFIRM_INSTANT
 )
 
 type Config struct {
@@ -10,11 +19,60 @@ type Config struct {
 	ChainId int
 	Port    int
 
-	Account string
-	Xpriv   string
+	RPCURLs          []string
+	EosChainID       string
+	RPCMaxLag        time.Duration
+	RPCProbeInterval time.Duration
+	RPCTimeout       time.Duration
+	RPCRetries       int
+	RPCBackoff       time.Duration
+
+	Account  string
+	Xpriv    string
+	Accounts []*WatchedAccount
+	Tokens   []*Token
 
 	LastBlock    uint64
+	LastAction   int64
 	RegistryAddr string
+	StorePath    string
+
+	TarsObj          string
+	TarsRegistryPort int
+	TarsTimeout      time.Duration
+	DepositMethod    string
+
+	ServantAddr    string
+	ServantObj     string
+	ServantTimeout time.Duration
+
+	// resource prices in the system token, per ms of CPU and KiB of NET
+	CPUPrice      *big.Rat
+	NetPrice      *big.Rat
+	CostPrecision int
+
+	SecurityLogPath string
+
+	OutboxInterval    time.Duration
+	OutboxBackoff     time.Duration
+	OutboxMaxBackoff  time.Duration
+	OutboxMaxAttempts int
+
+	Sinks          []string
+	WebhookURL     string
+	WebhookSecret  string
+	WebhookTimeout time.Duration
+	JSONLPath      string
+
+	ConfirmPolicy int
+	ConfirmBlocks uint64
+	BlockSource   string
+	ArchiveDir    string
+	ScanMode      string
+	HistoryAPI    string
+	HistoryURL    string
+	ShipURL       string
+	FetchWorkers  int
 }
 
 var cfg *ini.File
@@ -31,17 +89,140 @@ func LoadConfiguration(filepath string) (*Config, error) {
 	config.RPCURL = cfg.Section("network").Key("rpc_host").String()
 	config.ChainId = cfg.Section("network").Key("chain_id").MustInt(3)
 	config.Port = cfg.Section("network").Key("port").MustInt(8081)
+	config.RPCURLs = cfg.Section("network").Key("rpc_hosts").Strings(",")
+	if len(config.RPCURLs) == 0 && config.RPCURL != "" {
+		config.RPCURLs = []string{config.RPCURL}
+	}
+	if config.RPCURL == "" && len(config.RPCURLs) > 0 {
+		config.RPCURL = config.RPCURLs[0]
+	}
+	config.EosChainID = cfg.Section("network").Key("eos_chain_id").String()
+	config.RPCMaxLag = time.Duration(cfg.Section("network").Key("rpc_max_lag").MustInt(30)) * time.Second
+	config.RPCProbeInterval = time.Duration(cfg.Section("network").Key("rpc_probe_interval").MustInt(10)) * time.Second
+	config.RPCTimeout = time.Duration(cfg.Section("network").Key("rpc_timeout").MustInt(10)) * time.Second
+	config.RPCRetries = cfg.Section("network").Key("rpc_retries").MustInt(3)
+	config.RPCBackoff = time.Duration(cfg.Section("network").Key("rpc_backoff_ms").MustInt(500)) * time.Millisecond
 
 	config.Account = cfg.Section("account").Key("name").String()
 	config.Xpriv = cfg.Section("account").Key("xpriv").String()
 
 	config.LastBlock = uint64(cfg.Section("extapi").Key("lastBlock").MustInt(0))
+	config.LastAction = cfg.Section("extapi").Key("lastAction").MustInt64(0)
 	config.RegistryAddr = cfg.Section("extapi").Key("registry").String()
+	// an obj with its endpoint (obj@tcp -h host -p port) is called without
+	// the registry, as a local stand-in is
+	config.TarsObj = cfg.Section("extapi").Key("obj").MustString("NeexTrx.FreezingSysServer.FreezingSysObj")
+	config.TarsRegistryPort = cfg.Section("extapi").Key("registry_port").MustInt(17890)
+	config.TarsTimeout = time.Duration(cfg.Section("extapi").Key("timeout_ms").MustInt(3000)) * time.Millisecond
+	// user_into_dc2 only has the tx id, the transfers of one transaction
+	// would share it
+	config.DepositMethod = cfg.Section("extapi").Key("deposit_method").In(DEPOSIT_METHOD_DC3, []string{DEPOSIT_METHOD_DC2, DEPOSIT_METHOD_DC3})
+	config.ServantAddr = cfg.Section("servant").Key("address").String()
+	// under a Tars node the servant is App.Server.<obj> of its config
+	config.ServantObj = cfg.Section("servant").Key("obj").MustString("EosWalletObj")
+	config.ServantTimeout = time.Duration(cfg.Section("servant").Key("timeout_ms").MustInt(30000)) * time.Millisecond
+	config.StorePath = cfg.Section("store").Key("path").MustString("wallet.db")
+	config.SecurityLogPath = cfg.Section("security").Key("log").String()
+	config.OutboxInterval = time.Duration(cfg.Section("outbox").Key("interval_ms").MustInt(1000)) * time.Millisecond
+	config.OutboxBackoff = time.Duration(cfg.Section("outbox").Key("backoff_ms").MustInt(5000)) * time.Millisecond
+	config.OutboxMaxBackoff = time.Duration(cfg.Section("outbox").Key("max_backoff").MustInt(3600)) * time.Second
+	config.OutboxMaxAttempts = cfg.Section("outbox").Key("max_attempts").MustInt(30)
+
+	config.Sinks = cfg.Section("sinks").Key("enabled").Strings(",")
+	if len(config.Sinks) == 0 {
+		config.Sinks = []string{SINK_TARS}
+	}
+	config.WebhookURL = cfg.Section("sink.webhook").Key("url").String()
+	config.WebhookSecret = cfg.Section("sink.webhook").Key("secret").String()
+	config.WebhookTimeout = time.Duration(cfg.Section("sink.webhook").Key("timeout").MustInt(10)) * time.Second
+	config.JSONLPath = cfg.Section("sink.jsonl").Key("path").String()
+
+	if config.CPUPrice, err = loadPrice(cfg.Section("resources").Key("cpu_price")); err != nil {
+		return nil, err
+	}
+	if config.NetPrice, err = loadPrice(cfg.Section("resources").Key("net_price")); err != nil {
+		return nil, err
+	}
+
+	config.Tokens, err = loadTokens(cfg)
+	if err != nil {
+		return nil, err
+	}
+	// the costs are paid in the system token, a finer one could not be
+	// accounted
+	system := config.SystemToken()
+	config.CostPrecision = cfg.Section("resources").Key("precision").MustInt(system.Precision)
+	if config.CostPrecision < 0 || config.CostPrecision > system.Precision {
+		return nil, fmt.Errorf("invalid resources precision %d, %s has %d", config.CostPrecision, system.Symbol, system.Precision)
+	}
+
+	// the wallet account and then every [watch.<name>] section
+	base := &WatchedAccount{
+		MemoScheme:   MEMO_SCHEME_HASHIDS,
+		MemoSalt:     defaultMemoSalt,
+		RegistryAddr: config.RegistryAddr,
+		ChainId:      config.ChainId,
+		ActionPos:    config.LastAction,
+	}
+	if config.Account != "" {
+		account, err := loadWatchedAccount(cfg.Section("account"), config.Account, base)
+		if err != nil {
+			return nil, err
+		}
+		config.Accounts = append(config.Accounts, account)
+	}
+	base.ActionPos = 0
+	for _, section := range cfg.Sections() {
+		if !strings.HasPrefix(section.Name(), "watch.") {
+			continue
+		}
+		name := strings.TrimPrefix(section.Name(), "watch.")
+		if config.Watched(name) != nil {
+			return nil, fmt.Errorf("account %s is configured twice", name)
+		}
+		account, err := loadWatchedAccount(section, name, base)
+		if err != nil {
+			return nil, err
+		}
+		config.Accounts = append(config.Accounts, account)
+	}
+	for _, sink := range config.EnabledSinks() {
+		switch {
+		case sink == SINK_WEBHOOK && config.WebhookURL == "":
+			return nil, fmt.Errorf("webhook sink without url")
+		case sink == SINK_JSONL && config.JSONLPath == "":
+			return nil, fmt.Errorf("jsonl sink without path")
+		case sink != SINK_TARS && sink != SINK_WEBHOOK && sink != SINK_JSONL:
+			return nil, fmt.Errorf("unknown sink: %s", sink)
+		}
+	}
+
+	switch cfg.Section("scan").Key("confirm").MustString("lib") {
+	case "lib":
+		config.ConfirmPolicy = CONFIRM_LIB
+	case "blocks":
+		config.ConfirmPolicy = CONFIRM_BLOCKS
+	case "instant":
+		config.ConfirmPolicy = CONFIRM_INSTANT
+	default:
+		return nil, fmt.Errorf("unknown confirm policy: %s", cfg.Section("scan").Key("confirm").String())
+	}
+	config.ConfirmBlocks = uint64(cfg.Section("scan").Key("confirm_blocks").MustInt(12))
+	config.BlockSource = cfg.Section("scan").Key("source").MustString("nodeos")
+	config.ArchiveDir = cfg.Section("scan").Key("archive_dir").String()
+	config.ScanMode = cfg.Section("scan").Key("mode").In("blocks", []string{"blocks", "actions", "ship"})
+	config.HistoryAPI = cfg.Section("scan").Key("history_api").MustString("nodeos")
+	config.HistoryURL = cfg.Section("scan").Key("history_url").MustString(config.RPCURL)
+	config.ShipURL = cfg.Section("scan").Key("ship_url").String()
+	config.FetchWorkers = cfg.Section("scan").Key("fetch_workers").MustInt(4)
 
 	return config, nil
 }
 
-func SaveConfiguration(config *Config, filepath string) {
-	cfg.Section("extapi").Key("lastBlock").SetValue(strconv.FormatUint(config.LastBlock-1, 10))
-	cfg.SaveTo(filepath)
+func loadPrice(key *ini.Key) (*big.Rat, error) {
+	price, ok := new(big.Rat).SetString(key.MustString("0"))
+	if !ok || price.Sign() < 0 {
+		return nil, fmt.Errorf("invalid %s: %s", key.Name(), key.String())
+	}
+	return price, nil
 }
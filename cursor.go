@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// Cursor is the scan position, it is saved once the notifications of
+// the block have been handled. Number is the last block done and ID
+// its block id, empty when unknown. ActionPos is the next position to
+// read in the action history mode.
+type Cursor struct {
+	Number    uint64 `json:"number"`
+	ID        string `json:"id"`
+	ActionPos int64  `json:"action_pos"`
+	// last irreversible block when saved, the scan resumes after it if
+	// the block of the cursor is dropped by a fork
+	Irreversible uint64 `json:"irreversible,omitempty"`
+	// set for the action history cursor of a watched account
+	Account string `json:"account,omitempty"`
+}
+
+// RestoreCursor loads the cursor to resume from. Without a saved one,
+// it is taken from the lastBlock key of the old configuration or else
+// starts at the last irreversible block. A saved block dropped by a fork
+// while the wallet was stopped is scanned again from before the fork.
+func RestoreCursor(config *Config, store *Store, source BlockSource) (*Cursor, error) {
+	cursor, err := store.LoadCursor()
+	if err != nil {
+		return nil, err
+	}
+
+	if cursor == nil {
+		cursor = new(Cursor)
+		if config.LastBlock > 0 {
+			// the block saved in the configuration is scanned again
+			cursor.Number = config.LastBlock - 1
+			log.Println("cursor migrated from configuration, block:", config.LastBlock)
+		} else if config.ScanMode != "actions" {
+			info, err := source.HeadInfo()
+			if err != nil {
+				return nil, err
+			}
+			cursor.Number = uint64(info.LastIrreversibleBlockNum) - 1
+			log.Println("no cursor saved, start at last irreversible block", info.LastIrreversibleBlockNum)
+		}
+		if err = store.SaveCursor(cursor); err != nil {
+			return nil, err
+		}
+		return cursor, nil
+	}
+
+	if cursor.ID != "" && config.ScanMode != "actions" {
+		block, err := source.BlockByNum(uint32(cursor.Number))
+		if err != nil {
+			return nil, fmt.Errorf("verify cursor: %v", err)
+		}
+		if block.ID.String() != cursor.ID {
+			return rollbackCursor(store, source, cursor, block.ID.String())
+		}
+	}
+	return cursor, nil
+}
+
+// rollbackCursor moves the cursor back to the last block which was
+// irreversible when it was saved, the fork can't be before it. A cursor
+// saved without it goes back to the last irreversible block at most.
+func rollbackCursor(store *Store, source BlockSource, cursor *Cursor, onChain string) (*Cursor, error) {
+	fork := cursor.Irreversible
+	if fork == 0 {
+		info, err := source.HeadInfo()
+		if err != nil {
+			return nil, err
+		}
+		fork = uint64(info.LastIrreversibleBlockNum)
+	}
+	if fork >= cursor.Number {
+		fork = cursor.Number - 1
+	}
+	log.Printf("cursor block %d is %s on chain but %s was saved, rescan from %d\n", cursor.Number, onChain, cursor.ID, fork+1)
+
+	rolled := &Cursor{Number: fork, ActionPos: cursor.ActionPos}
+	if err := store.SaveCursor(rolled); err != nil {
+		return nil, err
+	}
+	return rolled, nil
+}
+
+// RestoreActionCursors returns the next action history position of each
+// watched account. The wallet account may still have its position in
+// the scan cursor, the others start at their configured position.
+func RestoreActionCursors(config *Config, store *Store, scan *Cursor) (map[string]int64, error) {
+	positions := make(map[string]int64)
+	for _, account := range config.Accounts {
+		cursor, err := store.LoadActionCursor(account.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case cursor != nil:
+			positions[account.Name] = cursor.ActionPos
+		case account.Name == config.Account && scan.ActionPos > 0:
+			positions[account.Name] = scan.ActionPos
+		default:
+			positions[account.Name] = account.ActionPos
+		}
+	}
+	return positions, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// BIP32 test vector 1
+const testXpriv = "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+
+type apiResponse struct {
+	Code int
+	Data map[string]interface{}
+}
+
+func callAPI(t *testing.T, server *httptest.Server, path string, form url.Values) apiResponse {
+	var rsp *http.Response
+	var err error
+	if form == nil {
+		rsp, err = http.Get(server.URL + path)
+	} else {
+		rsp, err = http.PostForm(server.URL+path, form)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	var out apiResponse
+	if err := json.NewDecoder(rsp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func hasCall(standIn *freezingStandIn, prefix string) bool {
+	for _, call := range standIn.Calls() {
+		if strings.HasPrefix(call, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestEndToEnd runs the HTTP API and the scan pipeline of main against
+// a fake nodeos, with the stand-in FreezingSys as sink.
+func TestEndToEnd(t *testing.T) {
+	store, cleanup := openTestStore(t)
+	defer cleanup()
+	standIn, stop := startFreezingStandIn(t)
+	defer stop()
+
+	nodeos := newFakeNodeos()
+	defer nodeos.Close()
+	nodeos.AddAccount("wallet", "alice", "bob")
+	nodeos.SetBalance("wallet", "100.0000 EOS")
+	nodeos.AddBlock(1, 0)
+	nodeos.SetLIB(1)
+
+	config := &Config{
+		Account:           "wallet",
+		Xpriv:             testXpriv,
+		RPCURLs:           []string{nodeos.URL},
+		EosChainID:        testChainID,
+		RPCTimeout:        5 * time.Second,
+		RPCRetries:        2,
+		RPCBackoff:        10 * time.Millisecond,
+		Accounts:          []*WatchedAccount{{Name: "wallet", ChainId: 3, MemoScheme: MEMO_SCHEME_UID}},
+		Tokens:            []*Token{EOSToken()},
+		ConfirmPolicy:     CONFIRM_LIB,
+		FetchWorkers:      2,
+		Sinks:             []string{SINK_TARS},
+		TarsObj:           standIn.Obj,
+		TarsTimeout:       3 * time.Second,
+		DepositMethod:     DEPOSIT_METHOD_DC2,
+		OutboxInterval:    20 * time.Millisecond,
+		OutboxBackoff:     50 * time.Millisecond,
+		OutboxMaxBackoff:  50 * time.Millisecond,
+		OutboxMaxAttempts: 10,
+	}
+
+	client := NewChainClient(config)
+	source := NewNodeosSource(client)
+	cursor, err := RestoreCursor(config, store, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	security, err := NewSecurityLog(config, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sinks, err := NewDepositSinks(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	heads, err := StartPipeline(ctx, config, source, store, security, sinks, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := httptest.NewServer(NewRouter(config, client, source, store))
+	defer api.Close()
+
+	scannedTo := func(num uint64) func() bool {
+		return func() bool {
+			cursor, _ := store.LoadCursor()
+			return cursor != nil && cursor.Number >= num
+		}
+	}
+
+	if rsp := callAPI(t, api, "/getBalance", nil); rsp.Code != 0 || rsp.Data["balance"] != "100.0000" {
+		t.Fatalf("unexpected balance %+v", rsp)
+	}
+	if rsp := callAPI(t, api, "/checkAddr?address=nobody", nil); rsp.Data["result"] != "invalid" {
+		t.Fatalf("unknown account checked %+v", rsp)
+	}
+	if rsp := callAPI(t, api, "/getMemo?uid=42", nil); rsp.Data["memo"] != "42" {
+		t.Fatalf("unexpected memo %+v", rsp)
+	}
+
+	// a deposit, and another one lost in a fork before it is irreversible
+	kept := testTransfer(t, "alice", "wallet", 10000, "42")
+	lost := testTransfer(t, "bob", "wallet", 20000, "7")
+	keptID, _ := kept.ID()
+	nodeos.AddBlock(2, 0, executedReceipt(kept))
+	nodeos.AddBlock(3, 0, executedReceipt(lost))
+	nodeos.SetLIB(2)
+	GetNewerBlock(source, heads)
+	waitFor(t, "the deposit", func() bool { return hasCall(standIn, "user_into_dc2 42 EOS "+keptID.String()) })
+
+	nodeos.AddBlock(3, 1)
+	nodeos.AddBlock(4, 1)
+	nodeos.SetLIB(4)
+	nodeos.Fail("get_block", 1)
+	GetNewerBlock(source, heads)
+	waitFor(t, "block 4", scannedTo(4))
+
+	// a withdraw, tracked until it is in a block
+	rsp := callAPI(t, api, "/sendEos", url.Values{"to": {"bob"}, "amount": {"2.5"}, "memo": {"w1"}})
+	hash, _ := rsp.Data["txhash"].(string)
+	if rsp.Code != 0 || hash == "" || len(nodeos.Pushed()) != 1 {
+		t.Fatalf("send failed %+v", rsp)
+	}
+	if rsp = callAPI(t, api, "/txStatus?hash="+hash, nil); rsp.Data["status"] != BROADCAST_PENDING {
+		t.Fatalf("unexpected status %+v", rsp)
+	}
+	nodeos.SetLIB(nodeos.MineBlock())
+	GetNewerBlock(source, heads)
+	waitFor(t, "the withdraw", func() bool { return hasCall(standIn, "commit_withdraw_dc "+hash+" EOS 2.5000") })
+	if rsp = callAPI(t, api, "/txStatus?hash="+hash, nil); rsp.Data["status"] != BROADCAST_CONFIRMED {
+		t.Fatalf("unexpected status %+v", rsp)
+	}
+
+	// refused by the chain
+	nodeos.Reject("overdrawn balance")
+	if rsp = callAPI(t, api, "/sendEos", url.Values{"to": {"bob"}, "amount": {"1000"}}); rsp.Code != 500 || !strings.Contains(rsp.Data["error"].(string), "overdrawn balance") {
+		t.Fatalf("rejected send answered %+v", rsp)
+	}
+	nodeos.Reject("")
+
+	// pushed but dropped, it expires
+	rsp = callAPI(t, api, "/sendEos", url.Values{"to": {"alice"}, "amount": {"1"}})
+	dropped, _ := rsp.Data["txhash"].(string)
+	nodeos.Drop()
+	nodeos.Advance(time.Minute)
+	nodeos.SetLIB(nodeos.MineBlock())
+	GetNewerBlock(source, heads)
+	waitFor(t, "the expiry", func() bool { return hasCall(standIn, "withdraw_failed_dc "+dropped+" EOS 1.0000 "+BROADCAST_EXPIRED) })
+
+	calls := standIn.Calls()
+	if len(calls) != 3 || strings.Contains(strings.Join(calls, "\n"), "user_into_dc2 7") {
+		t.Errorf("unexpected calls %q", calls)
+	}
+	if entries, _ := store.OutboxEntries(true); len(entries) != 0 {
+		t.Errorf("dead letters %+v", entries)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"log"
 	"math/big"
-	"strconv"
 	"time"
 
 	"github.com/btcsuite/btcutil/hdkeychain"
@@ -15,7 +14,6 @@ import (
 	"github.com/eoscanada/eos-go/btcsuite/btcutil"
 	"github.com/eoscanada/eos-go/ecc"
 	"github.com/eoscanada/eos-go/token"
-	"github.com/speps/go-hashids"
 )
 
 type TransferData struct {
@@ -58,16 +56,17 @@ type EosTrezorTx struct {
 	Transaction *Transaction `json:"transaction"`
 }
 
-func GetAddressBalance(config *Config, address string) (*big.Int, error) {
-	api := eos.New(config.RPCURL)
-	bals, err := api.GetCurrencyBalance(eos.AccountName(address), "EOS", "eosio.token")
+func GetAddressBalance(client *ChainClient, t *Token, address string) (*big.Int, error) {
+	bals, err := client.GetCurrencyBalance(address, t.Symbol, t.Contract)
 	if err != nil {
 		return nil, err
 	}
 
 	bgInt := new(big.Int)
-	if len(bals) > 0 {
-		bgInt.SetInt64(int64(bals[0].Amount))
+	for _, bal := range bals {
+		if bal.Symbol.Symbol == t.Symbol {
+			bgInt.SetInt64(int64(bal.Amount))
+		}
 	}
 	return bgInt, nil
 }
@@ -75,30 +74,23 @@ func GetAddressBalance(config *Config, address string) (*big.Int, error) {
 func ParseTransaction(tx *eos.SignedTransaction, id string, ts int64) []NotifyMessage {
 	var ans []NotifyMessage
 
-	for _, action := range tx.Transaction.Actions {
+	for i, action := range tx.Transaction.Actions {
 		account := action.Account
 		name := action.Name
-		if name == "transfer" && account == "eosio.token" {
+		if name == "transfer" {
 			transfer, _ := action.ActionData.Data.(*token.Transfer)
-			from := string(transfer.From)
-			dest := string(transfer.To)
-			quantity := transfer.Quantity
-			memo := transfer.Memo
-
-			if quantity.Symbol.Symbol == "EOS" {
-				if fDebug {
-					log.Printf("EOS: %s => %s / Value: %d Memo: %s\n", from, dest, int64(quantity.Amount), memo)
+			if transfer == nil {
+				// other contracts are checked against the token
+				// registry once they reach a watched account
+				transfer = new(token.Transfer)
+				if err := eos.UnmarshalBinary(action.ActionData.HexData, transfer); err != nil {
+					transfer = nil
 				}
-
-				ans = append(ans, NotifyMessage{
-					MessageType: NOTIFY_TYPE_TX,
-					AddressFrom: from,
-					AddressTo:   dest,
-					Amount:      big.NewInt(int64(quantity.Amount)),
-					Memo:        memo,
-					TxHash:      id,
-					BlockTime:   ts,
-				})
+			}
+			if msg, ok := ParseTransfer(transfer, string(account), id, ts); ok {
+				// the actions of a transaction come first in the ordinals
+				msg.Ordinal = uint32(i + 1)
+				ans = append(ans, msg)
 			}
 		}
 	}
@@ -106,41 +98,131 @@ func ParseTransaction(tx *eos.SignedTransaction, id string, ts int64) []NotifyMe
 	return ans
 }
 
-func ReadBlock(config *Config, number *big.Int) ([]NotifyMessage, error) {
+// ParseTransfer converts a transfer of a token contract into a
+// notification, ok is false if there is no transfer.
+func ParseTransfer(transfer *token.Transfer, contract string, id string, ts int64) (msg NotifyMessage, ok bool) {
+	if transfer == nil {
+		return
+	}
+
+	from := string(transfer.From)
+	dest := string(transfer.To)
+	quantity := transfer.Quantity
+	memo := transfer.Memo
+
+	if fDebug {
+		log.Printf("%s@%s: %s => %s / Value: %d Memo: %s\n", quantity.Symbol.Symbol, contract, from, dest, int64(quantity.Amount), memo)
+	}
+
+	return NotifyMessage{
+		MessageType: NOTIFY_TYPE_TX,
+		AddressFrom: from,
+		AddressTo:   dest,
+		Contract:    contract,
+		Symbol:      quantity.Symbol.Symbol,
+		Precision:   int(quantity.Symbol.Precision),
+		Amount:      big.NewInt(int64(quantity.Amount)),
+		Memo:        memo,
+		TxHash:      id,
+		BlockTime:   ts,
+	}, true
+}
+
+func ReadBlock(source BlockSource, number *big.Int) (*ScannedBlock, error) {
 	var err error
-	var messages []NotifyMessage
 
-	api := eos.New(config.RPCURL)
-	block, err := api.GetBlockByNum(uint32(number.Uint64()))
+	block, err := source.BlockByNum(uint32(number.Uint64()))
 	if err != nil {
-		return messages, fmt.Errorf("ReadBlock failed: %v", err)
+		return nil, fmt.Errorf("ReadBlock failed: %v", err)
 	}
 
+	scanned := &ScannedBlock{
+		Number:   number.Uint64(),
+		ID:       block.ID.String(),
+		Previous: block.Previous.String(),
+		Time:     block.SignedBlock.SignedBlockHeader.Timestamp.Time.Unix(),
+	}
+
+	ts := scanned.Time
 	for _, tx := range block.SignedBlock.Transactions {
-		status := tx.TransactionReceiptHeader.Status.String()
-		if status != "executed" {
-			log.Println("tx is bad:", status)
-		} else {
-			id := tx.Transaction.ID.String()
-			if tx.Transaction.Packed == nil {
-				fmt.Println("packed is nil")
+		status := tx.TransactionReceiptHeader.Status
+		// a delayed transaction is seen again when it runs
+		if status == eos.TransactionStatusDelayed {
+			continue
+		}
+
+		id := tx.Transaction.ID.String()
+
+		var msgs []NotifyMessage
+		if tx.Transaction.Packed != nil {
+			signedTx, err := tx.Transaction.Packed.Unpack()
+			if err != nil {
+				log.Println("unpack tx", id, "err:", err)
 				continue
 			}
+			msgs = ParseTransaction(signedTx, id, ts)
+		} else {
+			// a deferred transaction, the block only has its id. The
+			// block is read again until the lookup answers, its
+			// transfers would be lost past it
+			msgs, err = ReadDeferredTransaction(source, id, ts)
+			if err != nil {
+				return nil, fmt.Errorf("ReadBlock %d: deferred tx %s: %v", scanned.Number, id, err)
+			}
+		}
 
-			signedTx, err := tx.Transaction.Packed.Unpack()
-			if err == nil && packHash == "" || packHash == id {
-				msgs := ParseTransaction(signedTx, id, block.SignedBlock.SignedBlockHeader.Timestamp.Time.Unix())
-				if len(msgs) > 0 {
-					messages = append(messages, msgs...)
-				}
+		shareResources(msgs, len(msgs))
+		for _, msg := range msgs {
+			msg.BlockNum = scanned.Number
+			msg.CPUUsage = tx.TransactionReceiptHeader.CPUUsageMicroSeconds
+			msg.NetUsage = uint32(tx.TransactionReceiptHeader.NetUsageWords)
+			if status == eos.TransactionStatusExecuted {
+				scanned.Txns = append(scanned.Txns, msg)
+			} else {
+				log.Println("tx", id, "is", status.String())
+				msg.Status = status.String()
+				scanned.Failed = append(scanned.Failed, msg)
 			}
 		}
 	}
 
-	return messages, nil
+	return scanned, nil
+}
+
+// ReadDeferredTransaction parses the transfers of a deferred
+// transaction from the transaction lookup of the source.
+func ReadDeferredTransaction(source BlockSource, id string, ts int64) ([]NotifyMessage, error) {
+	lookup, ok := source.(TransactionSource)
+	if !ok {
+		return nil, fmt.Errorf("no transaction lookup")
+	}
+	rsp, err := lookup.TransactionByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.Transaction.Transaction.Transaction == nil {
+		return nil, fmt.Errorf("no transaction body")
+	}
+
+	var ans []NotifyMessage
+	for i, action := range rsp.Transaction.Transaction.Actions {
+		if action.Name != "transfer" {
+			continue
+		}
+		transfer, err := decodeTransfer(action.ActionData.Data)
+		if err != nil {
+			log.Println("decode transfer of", id, "err:", err)
+			continue
+		}
+		if msg, ok := ParseTransfer(transfer, string(action.Account), id, ts); ok {
+			msg.Ordinal = uint32(i + 1)
+			ans = append(ans, msg)
+		}
+	}
+	return ans, nil
 }
 
-func VerifyAddress(config *Config, addr string) bool {
+func VerifyAddress(client *ChainClient, addr string) bool {
 	if len(addr) > 12 {
 		return false
 	}
@@ -156,39 +238,36 @@ func VerifyAddress(config *Config, addr string) bool {
 		return false
 	}
 
-	api := eos.New(config.RPCURL)
-	_, err = api.GetAccount(eos.AccountName(addr))
+	_, err = client.GetAccount(addr)
 	if err != nil {
+		if _, ok := err.(*TransportError); ok {
+			log.Println("verify address", addr, "err:", err)
+		}
 		return false
 	}
 
 	return true
 }
 
-func SendEosCoin(config *Config, to string, amount int64, memo string) (string, error) {
-	wif, _ := ExtractPrivPubKey(config.Xpriv, 0)
-	keyBag := eos.NewKeyBag()
-	keyBag.Add(wif)
-
-	api := eos.New(config.RPCURL)
-	api.SetSigner(keyBag)
-
-	actions := []*eos.Action{token.NewTransfer(eos.AccountName(config.Account), eos.AccountName(to), eos.NewEOSAsset(amount), memo)}
-	rsp, err := api.SignPushActionsWithOpts(actions, nil)
+// SendToken returns the id of the transaction and a time after which it
+// can no longer be included.
+func SendToken(config *Config, client *ChainClient, t *Token, to string, amount int64, memo string) (string, time.Time, error) {
+	actions := []*eos.Action{t.TransferAction(config.Account, to, amount, memo)}
+	// the transaction is filled with an expiration 30s from now
+	expiration := time.Now().Add(30 * time.Second)
+	rsp, err := client.SignPushActions(actions)
 
 	if rsp == nil {
-		return "", err
+		return "", expiration, err
 	}
-	return rsp.TransactionID, err
+	return rsp.TransactionID, expiration, err
 }
 
 var blockID eos.Checksum256
 var lastExp string
 
-func PrepareTrezorEosSign(config *Config, to string, amount int64, memo string) (string, error) {
-	api := eos.New(config.RPCURL)
-
-	info, err := api.GetInfo()
+func PrepareTrezorEosSign(config *Config, client *ChainClient, t *Token, to string, amount int64, memo string) (string, error) {
+	info, err := client.GetInfo()
 	if err != nil {
 		log.Println("get info err:", err)
 		return "", err
@@ -207,7 +286,7 @@ func PrepareTrezorEosSign(config *Config, to string, amount int64, memo string)
 			},
 			Actions: []TransferAction{
 				TransferAction{
-					Account: "eosio.token",
+					Account: t.Contract,
 					Name:    "transfer",
 					Authorization: []Auth{
 						Auth{
@@ -218,7 +297,7 @@ func PrepareTrezorEosSign(config *Config, to string, amount int64, memo string)
 					TransferData: TransferData{
 						From:     config.Account,
 						To:       to,
-						Quantity: eos.NewEOSAsset(amount).String(),
+						Quantity: t.Asset(amount).String(),
 						Memo:     memo,
 					},
 				},
@@ -230,10 +309,8 @@ func PrepareTrezorEosSign(config *Config, to string, amount int64, memo string)
 	return string(bs), nil
 }
 
-func SendSignedEosTx(config *Config, to string, amount int64, memo string, sig string) (string, error) {
-	api := eos.New(config.RPCURL)
-
-	actions := []*eos.Action{token.NewTransfer(eos.AccountName(config.Account), eos.AccountName(to), eos.NewEOSAsset(amount), memo)}
+func SendSignedEosTx(config *Config, client *ChainClient, t *Token, to string, amount int64, memo string, sig string) (string, time.Time, error) {
+	actions := []*eos.Action{t.TransferAction(config.Account, to, amount, memo)}
 	tx := eos.NewTransaction(actions, nil)
 	tx.Fill(blockID, 0, 0, 0)
 	tx.Expiration, _ = eos.ParseJSONTime(lastExp)
@@ -243,11 +320,11 @@ func SendSignedEosTx(config *Config, to string, amount int64, memo string, sig s
 	stx.Signatures = append(stx.Signatures, signature)
 	packedTx, _ := stx.Pack(eos.CompressionZlib)
 
-	rsp, err := api.PushTransaction(packedTx)
+	rsp, err := client.PushTransaction(packedTx)
 	if rsp == nil {
-		return "", err
+		return "", tx.Expiration.Time, err
 	}
-	return rsp.TransactionID, err
+	return rsp.TransactionID, tx.Expiration.Time, err
 }
 
 func ExtractPrivPubKey(xpriv string, index int) (wif, pkStr string) {
@@ -269,29 +346,3 @@ func ExtractPrivPubKey(xpriv string, index int) (wif, pkStr string) {
 	wif, pkStr = wifObj.String(), eccPub.String()
 	return
 }
-
-func CreateMemoByUID(uid uint64) string {
-	hd := hashids.NewData()
-	hd.Salt = "mohu@2020"
-	hd.Alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ23456789"
-	hd.MinLength = 5
-
-	h, _ := hashids.NewWithData(hd)
-	newID, _ := h.EncodeHex(strconv.FormatUint(uid, 16))
-	return newID
-}
-
-func ParseMemoToUID(memo string) (uid uint64, err error) {
-	hd := hashids.NewData()
-	hd.Salt = "mohu@2020"
-	hd.Alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ23456789"
-	hd.MinLength = 5
-
-	h, _ := hashids.NewWithData(hd)
-	d, err := h.DecodeHex(memo)
-	if err != nil {
-		return
-	}
-	uid, err = strconv.ParseUint(d, 16, 64)
-	return
-}
@@ -1,42 +1,201 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"github.com/TarsCloud/TarsGo/tars"
 	"github.com/bytefly/eos-wallet/NeexTrx"
 	"log"
+	"time"
 )
 
-func storeTokenDepositTx(config *Config, token string, hash string, addr string, amount string) {
-	comm := tars.NewCommunicator()
-	obj := "NeexTrx.FreezingSysServer.FreezingSysObj"
-	registry := config.RegistryAddr
-	comm.SetProperty("locator", "tars.tarsregistry.QueryObj@tcp -h "+registry+" -p 17890")
-	app := new(NeexTrx.FreezingSys)
+const (
+	DEPOSIT_METHOD_DC2 = "user_into_dc2"
+	DEPOSIT_METHOD_DC3 = "user_into_dc3"
+)
+
+// TarsSink calls NeexTrx.FreezingSys, with one proxy for each registry
+// of the watched accounts made at startup.
+type TarsSink struct {
+	ctx     context.Context
+	timeout time.Duration
+	method  string
+	proxies map[string]*NeexTrx.FreezingSys
+}
+
+func NewTarsSink(ctx context.Context, config *Config) *TarsSink {
+	s := &TarsSink{ctx: ctx, timeout: config.TarsTimeout, method: config.DepositMethod, proxies: make(map[string]*NeexTrx.FreezingSys)}
+	for _, account := range config.Accounts {
+		if _, ok := s.proxies[account.RegistryAddr]; ok {
+			continue
+		}
+
+		comm := tars.NewCommunicator()
+		comm.SetProperty("locator", fmt.Sprintf("tars.tarsregistry.QueryObj@tcp -h %s -p %d", account.RegistryAddr, config.TarsRegistryPort))
+		app := new(NeexTrx.FreezingSys)
+		comm.StringToProxy(config.TarsObj, app)
+		app.TarsSetTimeout(int(config.TarsTimeout / time.Millisecond))
+		s.proxies[account.RegistryAddr] = app
+	}
+	return s
+}
+
+func (s *TarsSink) proxy(account *WatchedAccount) (*NeexTrx.FreezingSys, error) {
+	app, ok := s.proxies[account.RegistryAddr]
+	if !ok {
+		return nil, fmt.Errorf("no freezing proxy for registry %s", account.RegistryAddr)
+	}
+	return app, nil
+}
+
+// call runs a FreezingSys call which is given up when the sink context
+// is cancelled, the proxy does not watch the context itself.
+func (s *TarsSink) call(fn func(ctx context.Context) (bool, error)) (bool, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, s.timeout)
+	defer cancel()
+
+	type result struct {
+		ret bool
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ret, err := fn(ctx)
+		done <- result{ret, err}
+	}()
 
-	comm.StringToProxy(obj, app)
+	select {
+	case r := <-done:
+		return r.ret, r.err
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+func (s *TarsSink) Deposit(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	app, err := s.proxy(account)
+	if err != nil {
+		return false, err
+	}
+
+	// the entries queued without their source can only go to dc2
+	if s.method == DEPOSIT_METHOD_DC3 && entry.Deposit != nil {
+		return s.depositInfo(app, account, entry)
+	}
 
-	ret, err := app.User_into_dc2(addr, token, hash, amount, int32(config.ChainId))
+	ret, err := s.call(func(ctx context.Context) (bool, error) {
+		return app.User_into_dc2WithContext(ctx, entry.Addr, entry.Symbol, entry.Hash, entry.Amount, int32(account.ChainId))
+	})
 	if err != nil {
 		log.Println("call freezing deposit err:", err)
-		return
+		return false, err
 	}
 	log.Println("call freezing deposit result:", ret)
+	return ret, nil
 }
 
-func storeTokenWithdrawTx(config *Config, token string, hash string, addr string, amount string, fee string) {
-	comm := tars.NewCommunicator()
-	obj := "NeexTrx.FreezingSysServer.FreezingSysObj"
-	registry := config.RegistryAddr
-	comm.SetProperty("locator", "tars.tarsregistry.QueryObj@tcp -h "+registry+" -p 17890")
-	app := new(NeexTrx.FreezingSys)
+func (s *TarsSink) depositInfo(app *NeexTrx.FreezingSys, account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	info := &NeexTrx.DepositInfo{
+		Hash:          entry.Hash,
+		Symbol:        entry.Symbol,
+		Amount:        entry.Amount,
+		Type:          int32(account.ChainId),
+		Sender:        entry.Deposit.Sender,
+		Account:       account.Name,
+		Uid:           int64(entry.Deposit.Uid),
+		Memo:          entry.Deposit.Memo,
+		BlockNum:      int64(entry.Deposit.BlockNum),
+		BlockTime:     entry.Deposit.BlockTime,
+		ActionOrdinal: int32(entry.Deposit.Ordinal),
+		Status:        entry.Deposit.Confirmation,
+		Contract:      entry.Deposit.Contract,
+	}
+
+	var rsp string
+	ret, err := s.call(func(ctx context.Context) (bool, error) {
+		return app.User_into_dc3WithContext(ctx, info, &rsp)
+	})
+	if err != nil {
+		log.Println("call freezing deposit info err:", err)
+		return false, err
+	}
+	log.Println("call freezing deposit info result:", ret, ", rsp:", rsp, ", hash:", entry.Hash)
+	entry.Response = rsp
+	return ret, nil
+}
 
-	comm.StringToProxy(obj, app)
+func (s *TarsSink) Withdraw(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	app, err := s.proxy(account)
+	if err != nil {
+		return false, err
+	}
 
 	var rsp string
-	ret, err := app.Commit_withdraw_dc(hash, token, amount, fee, &rsp)
+	ret, err := s.call(func(ctx context.Context) (bool, error) {
+		return app.Commit_withdraw_dcWithContext(ctx, entry.Hash, entry.Symbol, entry.Amount, entry.Fee, &rsp)
+	})
 	if err != nil {
 		log.Println("call freezing withdraw err:", err)
-		return
+		return false, err
+	}
+	log.Println("call freezing withdraw result:", ret, ", rsp:", rsp, ", hash:", entry.Hash)
+	entry.Response = rsp
+	return ret, nil
+}
+
+func (s *TarsSink) Fee(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	app, err := s.proxy(account)
+	if err != nil {
+		return false, err
+	}
+
+	var rsp string
+	ret, err := s.call(func(ctx context.Context) (bool, error) {
+		return app.Insert_innerexchange_feeWithContext(ctx, entry.Hash, entry.Fee, &rsp)
+	})
+	if err != nil {
+		log.Println("call freezing fee err:", err)
+		return false, err
+	}
+	log.Println("call freezing fee result:", ret, ", rsp:", rsp, ", hash:", entry.Hash)
+	entry.Response = rsp
+	return ret, nil
+}
+
+func (s *TarsSink) WithdrawFailed(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	app, err := s.proxy(account)
+	if err != nil {
+		return false, err
+	}
+
+	var rsp string
+	ret, err := s.call(func(ctx context.Context) (bool, error) {
+		return app.Withdraw_failed_dcWithContext(ctx, entry.Hash, entry.Symbol, entry.Amount, entry.Status, entry.Reason, &rsp)
+	})
+	if err != nil {
+		log.Println("call freezing withdraw failed err:", err)
+		return false, err
+	}
+	log.Println("call freezing withdraw failed result:", ret, ", rsp:", rsp, ", hash:", entry.Hash)
+	entry.Response = rsp
+	return ret, nil
+}
+
+func (s *TarsSink) Revert(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	app, err := s.proxy(account)
+	if err != nil {
+		return false, err
+	}
+
+	var rsp string
+	ret, err := s.call(func(ctx context.Context) (bool, error) {
+		return app.Revert_dcWithContext(ctx, entry.Hash, int32(entry.Ordinal), entry.Reverted, entry.Symbol, entry.Amount, entry.Addr, int32(account.ChainId), &rsp)
+	})
+	if err != nil {
+		log.Println("call freezing revert err:", err)
+		return false, err
 	}
-	log.Println("call freezing withdraw result:", ret, ", rsp:", rsp, ", hash:", hash)
+	log.Println("call freezing revert result:", ret, ", rsp:", rsp, ", hash:", entry.Hash)
+	entry.Response = rsp
+	return ret, nil
 }
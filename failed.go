@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// FailedTx is a transfer involving a watched account whose transaction
+// soft failed, hard failed or expired, kept so support can tell why a
+// transfer never arrived.
+type FailedTx struct {
+	Key       string `json:"key"`
+	Account   string `json:"account"`
+	Status    string `json:"status"`
+	TxHash    string `json:"tx_hash"`
+	BlockNum  uint64 `json:"block_num"`
+	BlockTime int64  `json:"block_time"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Contract  string `json:"contract"`
+	Symbol    string `json:"symbol"`
+	Amount    string `json:"amount"`
+	Memo      string `json:"memo"`
+}
+
+func failedKey(account string, message *NotifyMessage) string {
+	return fmt.Sprintf("%s/%s:%d", account, message.TxHash, message.Ordinal)
+}
+
+func (s *Store) RecordFailure(account string, message *NotifyMessage) error {
+	failed := &FailedTx{
+		Key:       message.Key(),
+		Account:   account,
+		Status:    message.Status,
+		TxHash:    message.TxHash,
+		BlockNum:  message.BlockNum,
+		BlockTime: message.BlockTime,
+		From:      message.AddressFrom,
+		To:        message.AddressTo,
+		Contract:  message.Contract,
+		Symbol:    message.Symbol,
+		Amount:    LeftShift(message.Amount.String(), message.Precision),
+		Memo:      message.Memo,
+	}
+	return s.put(bucketFailed, []byte(failedKey(account, message)), failed)
+}
+
+// FailedTxs returns the failed transfers of an account, all accounts if
+// it is empty, only those of one transaction if tx is set.
+func (s *Store) FailedTxs(account string, tx string) ([]FailedTx, error) {
+	var prefix []byte
+	if account != "" {
+		prefix = []byte(account + "/")
+	}
+
+	var txs []FailedTx
+	err := s.db.View(func(btx *bolt.Tx) error {
+		c := btx.Bucket(bucketFailed).Cursor()
+		for k, v := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = c.Next() {
+			var failed FailedTx
+			if err := json.Unmarshal(v, &failed); err != nil {
+				return err
+			}
+			if tx == "" || failed.TxHash == tx {
+				txs = append(txs, failed)
+			}
+		}
+		return nil
+	})
+	return txs, err
+}
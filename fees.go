@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	FEE_PENDING  = "pending"
+	FEE_RETRYING = "retrying"
+	FEE_ACCEPTED = "accepted"
+	FEE_DEAD     = "dead"
+)
+
+// FeeRecord is the state of a fee reported to a sink, with the answer
+// of the sink to the last attempt.
+type FeeRecord struct {
+	Key       string `json:"key"`
+	Sink      string `json:"sink"`
+	Account   string `json:"account"`
+	Hash      string `json:"hash"`
+	Fee       string `json:"fee"`
+	Symbol    string `json:"symbol,omitempty"`
+	Amount    string `json:"amount,omitempty"`
+	Manual    bool   `json:"manual"`
+	Status    string `json:"status"`
+	Attempts  int    `json:"attempts"`
+	Response  string `json:"response,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+	Updated   int64  `json:"updated"`
+}
+
+func putFeeRecord(tx *bolt.Tx, entry *OutboxEntry, status string) error {
+	record := &FeeRecord{
+		Key:       entry.Key,
+		Sink:      entry.Sink,
+		Account:   entry.Account,
+		Hash:      entry.Hash,
+		Fee:       entry.Fee,
+		Symbol:    entry.Symbol,
+		Amount:    entry.Amount,
+		Manual:    entry.Manual,
+		Status:    status,
+		Attempts:  entry.Attempts,
+		Response:  entry.Response,
+		LastError: entry.LastError,
+		Updated:   time.Now().Unix(),
+	}
+	if status == FEE_ACCEPTED {
+		record.LastError = ""
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucketFees).Put([]byte(entry.Key), data)
+}
+
+// FeeRecords returns the fees reported for an account, all accounts if
+// it is empty.
+func (s *Store) FeeRecords(account string) ([]FeeRecord, error) {
+	records := []FeeRecord{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketFees).ForEach(func(k, v []byte) error {
+			var record FeeRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+			if account == "" || record.Account == account {
+				records = append(records, record)
+			}
+			return nil
+		})
+	})
+	return records, err
+}
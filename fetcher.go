@@ -0,0 +1,138 @@
+package main
+
+import (
+	"log"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const fetchStatsInterval = 10 * time.Second
+
+// FetchedBlock is the outcome of reading one block.
+type FetchedBlock struct {
+	Number uint64
+	Block  *ScannedBlock
+	Err    error
+}
+
+// BlockFetcher reads ranges of blocks with a pool of workers and
+// delivers them strictly in block order.
+type BlockFetcher struct {
+	source  BlockSource
+	workers int
+
+	fetched uint64
+	elapsed int64
+}
+
+func NewBlockFetcher(source BlockSource, workers int) *BlockFetcher {
+	if workers < 1 {
+		workers = 1
+	}
+	return &BlockFetcher{source: source, workers: workers}
+}
+
+// Stats returns the number of blocks delivered so far and the average
+// throughput in blocks per second.
+func (f *BlockFetcher) Stats() (uint64, float64) {
+	fetched := atomic.LoadUint64(&f.fetched)
+	elapsed := time.Duration(atomic.LoadInt64(&f.elapsed))
+	if elapsed <= 0 {
+		return fetched, 0
+	}
+	return fetched, float64(fetched) / elapsed.Seconds()
+}
+
+// Fetch reads the blocks from and to included. The returned channel is
+// closed after the last block, or once cancel is called. A block which
+// can't be read is delivered with Err set.
+func (f *BlockFetcher) Fetch(from uint64, to uint64) (<-chan FetchedBlock, func()) {
+	out := make(chan FetchedBlock)
+	jobs := make(chan uint64)
+	results := make(chan FetchedBlock, f.workers)
+	done := make(chan struct{})
+	// bounds the blocks read ahead of the one awaited
+	window := make(chan struct{}, f.workers*4)
+
+	go func() {
+		defer close(jobs)
+		for n := from; n <= to; n++ {
+			select {
+			case window <- struct{}{}:
+			case <-done:
+				return
+			}
+			select {
+			case jobs <- n:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < f.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range jobs {
+				block, err := ReadBlock(f.source, new(big.Int).SetUint64(n))
+				select {
+				case results <- FetchedBlock{Number: n, Block: block, Err: err}:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	go func() {
+		defer close(out)
+
+		buffer := make(map[uint64]FetchedBlock)
+		next := from
+		start := time.Now()
+		prev, lastLog := start, start
+		var count uint64
+		for result := range results {
+			buffer[result.Number] = result
+			for {
+				ready, ok := buffer[next]
+				if !ok {
+					break
+				}
+				delete(buffer, next)
+
+				select {
+				case out <- ready:
+				case <-done:
+					return
+				}
+				<-window
+				next++
+				count++
+
+				now := time.Now()
+				atomic.AddUint64(&f.fetched, 1)
+				atomic.AddInt64(&f.elapsed, int64(now.Sub(prev)))
+				prev = now
+				if now.Sub(lastLog) >= fetchStatsInterval {
+					log.Printf("fetched %d blocks up to %d, %.1f blocks/s with %d workers\n", count, next-1, float64(count)/now.Sub(start).Seconds(), f.workers)
+					lastLog = now
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() { close(done) })
+	}
+	return out, cancel
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eoscanada/eos-go"
+)
+
+// slowSource answers the lower blocks last so the workers complete out
+// of order.
+type slowSource struct {
+	*MemorySource
+}
+
+func (s slowSource) BlockByNum(num uint32) (*eos.BlockResp, error) {
+	time.Sleep(time.Duration(10-num%10) * time.Millisecond)
+	return s.MemorySource.BlockByNum(num)
+}
+
+func TestBlockFetcherKeepsOrder(t *testing.T) {
+	chain := newTestChain()
+	for i := uint32(1); i <= 50; i++ {
+		chain.add(i, 0)
+	}
+
+	fetcher := NewBlockFetcher(slowSource{chain.source}, 8)
+	blocks, cancel := fetcher.Fetch(1, 50)
+	defer cancel()
+
+	next := uint64(1)
+	for fetched := range blocks {
+		if fetched.Err != nil {
+			t.Fatal(fetched.Err)
+		}
+		if fetched.Number != next || fetched.Block.Number != next {
+			t.Fatalf("got block %d, want %d", fetched.Number, next)
+		}
+		next++
+	}
+	if next != 51 {
+		t.Fatalf("stopped at block %d", next)
+	}
+	if count, _ := fetcher.Stats(); count != 50 {
+		t.Errorf("stats count %d, want 50", count)
+	}
+}
+
+func TestBlockFetcherCancel(t *testing.T) {
+	chain := newTestChain()
+	for i := uint32(1); i <= 50; i++ {
+		chain.add(i, 0)
+	}
+
+	fetcher := NewBlockFetcher(chain.source, 4)
+	blocks, cancel := fetcher.Fetch(1, 50)
+	<-blocks
+	cancel()
+	for range blocks {
+	}
+}
@@ -7,9 +7,11 @@ require (
 	github.com/btcsuite/btcutil v1.0.2
 	github.com/eoscanada/eos-go v0.9.0
 	github.com/gorilla/mux v1.7.4
+	github.com/gorilla/websocket v1.4.2
 	github.com/smartystreets/goconvey v1.6.4 // indirect
 	github.com/speps/go-hashids v2.0.0+incompatible
 	github.com/tidwall/sjson v1.1.1 // indirect
+	go.etcd.io/bbolt v1.3.5
 	go.uber.org/zap v1.15.0 // indirect
 	golang.org/x/crypto v0.0.0-20200510223506-06a226fb4e37 // indirect
 	gopkg.in/ini.v1 v1.56.0
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"math/big"
 	"net/http"
 	"strconv"
 	"sync"
@@ -41,6 +40,15 @@ func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
 	RespondWithError(w, 404, "Not found")
 }
 
+// requestToken returns the token of the symbol parameter, EOS when it
+// is missing, nil if the token is not registered.
+func requestToken(config *Config, symbol string) *Token {
+	if symbol == "" {
+		symbol = "EOS"
+	}
+	return config.TokenBySymbol(symbol)
+}
+
 func GetMemoHandler(config *Config) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		arg := r.URL.Query().Get("uid")
@@ -55,43 +63,29 @@ func GetMemoHandler(config *Config) func(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
-		memo := CreateMemoByUID(uid)
-		log.Println("create memo of", uid, ":", memo)
-		Respond(w, 0, map[string]string{"memo": memo})
+		memo, name, err := GetMemo(config, r.URL.Query().Get("account"), uid)
+		if err != nil {
+			RespondWithError(w, errorCode(err), err.Error())
+			return
+		}
+		Respond(w, 0, map[string]string{"memo": memo, "account": name})
 		return
 	}
 }
 
-func GetBalanceHandler(config *Config) func(w http.ResponseWriter, r *http.Request) {
+func GetBalanceHandler(config *Config, client *ChainClient) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var balance *big.Int
-		var err error
-
-		address := r.URL.Query().Get("address")
-		if address == "" {
-			address = config.Account
-		}
-		if !VerifyAddress(config, address) {
-			log.Println("Invalid address:", address)
-			RespondWithError(w, 400, "Invalid address")
-			return
-		}
-
-		// Retrieve EOS balance
-		balance, err = GetAddressBalance(config, address)
+		t, balance, err := GetBalance(config, client, r.URL.Query().Get("symbol"), r.URL.Query().Get("address"))
 		if err != nil {
-			log.Println("get eos balance of", address, "err:", err)
-			RespondWithError(w, 500, fmt.Sprintf("Could not retrieve EOS balance: %v", err))
+			RespondWithError(w, errorCode(err), err.Error())
 			return
 		}
-
-		log.Println("get eos balance of", address, ":", balance.String())
-		Respond(w, 0, map[string]string{"balance": LeftShift(balance.String(), 4)})
+		Respond(w, 0, map[string]string{"balance": balance, "symbol": t.Symbol})
 		return
 	}
 }
 
-func SendEosHandler(config *Config) func(w http.ResponseWriter, r *http.Request) {
+func SendEosHandler(config *Config, client *ChainClient, store *Store) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		err := r.ParseForm()
 		if err != nil {
@@ -100,40 +94,9 @@ func SendEosHandler(config *Config) func(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
-		to := r.Form.Get("to")
-		amount := r.Form.Get("amount")
-		memo := r.Form.Get("memo")
-
-		log.Println("send EOS to", to, "amount:", amount)
-		if to == "" {
-			log.Println("Got Send EOS order but to field is missing")
-			RespondWithError(w, 400, "Missing to field")
-			return
-		}
-		if !VerifyAddress(config, to) {
-			log.Println("Invalid to address:", to)
-			RespondWithError(w, 400, "Invalid to address")
-			return
-		}
-
-		if amount == "" {
-			log.Println("Got Send EOS order but 'amount' field is missing")
-			RespondWithError(w, 400, "Missing 'amount' field")
-			return
-		}
-
-		_, err = strconv.ParseFloat(amount, 64)
+		tx, err := SendTransfer(config, client, store, r.Form.Get("symbol"), r.Form.Get("to"), r.Form.Get("amount"), r.Form.Get("memo"))
 		if err != nil {
-			RespondWithError(w, 400, "Could not convert amount")
-			return
-		}
-
-		bgAmountInt := new(big.Int)
-		bgAmountInt.SetString(RightShift(amount, 4), 10)
-		tx, err := SendEosCoin(config, to, bgAmountInt.Int64(), memo)
-		if err != nil {
-			log.Println("send EOS err:", err)
-			RespondWithError(w, 500, fmt.Sprintf("Could not send EOS: %v", err))
+			RespondWithError(w, errorCode(err), err.Error())
 			return
 		}
 
@@ -141,7 +104,7 @@ func SendEosHandler(config *Config) func(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-func PrepareTrezorEosSignHandler(config *Config) func(w http.ResponseWriter, r *http.Request) {
+func PrepareTrezorEosSignHandler(config *Config, client *ChainClient) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		err := r.ParseForm()
 		if err != nil {
@@ -151,30 +114,16 @@ func PrepareTrezorEosSignHandler(config *Config) func(w http.ResponseWriter, r *
 		}
 
 		to := r.Form.Get("to")
-		amountStr := r.Form.Get("amount")
 		memo := r.Form.Get("memo")
 
-		log.Println("PrepareTrezorEosSign:", to, amountStr)
-		if to == "" || amountStr == "" {
-			log.Println("parameters not enought")
-			RespondWithError(w, 400, "Missing some fields")
-			return
-		}
-
-		amount, ok := new(big.Int).SetString(RightShift(amountStr, 4), 10)
-		if !ok {
-			log.Println("invalid amount")
-			RespondWithError(w, 400, "Invalid amount")
-			return
-		}
-
-		if !VerifyAddress(config, to) {
-			log.Println("invalid to address:", to)
-			RespondWithError(w, 400, "invalid to address")
+		log.Println("PrepareTrezorEosSign:", to, r.Form.Get("amount"))
+		t, amount, err := TransferParams(config, client, r.Form.Get("symbol"), to, r.Form.Get("amount"))
+		if err != nil {
+			RespondWithError(w, errorCode(err), err.Error())
 			return
 		}
 
-		unsignedTx, err := PrepareTrezorEosSign(config, to, amount.Int64(), memo)
+		unsignedTx, err := PrepareTrezorEosSign(config, client, t, to, amount.Int64(), memo)
 		if err != nil {
 			RespondWithError(w, 500, fmt.Sprintf("prepare trezor Eos Sign err: %v", err))
 		} else {
@@ -183,7 +132,7 @@ func PrepareTrezorEosSignHandler(config *Config) func(w http.ResponseWriter, r *
 	}
 }
 
-func SendSignedEosTxHandler(config *Config) func(w http.ResponseWriter, r *http.Request) {
+func SendSignedEosTxHandler(config *Config, client *ChainClient, store *Store) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		err := r.ParseForm()
 		if err != nil {
@@ -192,42 +141,35 @@ func SendSignedEosTxHandler(config *Config) func(w http.ResponseWriter, r *http.
 			return
 		}
 
-		amountStr := r.Form.Get("amount")
 		to := r.Form.Get("to")
 		memo := r.Form.Get("memo")
 		sig := r.Form.Get("sig")
 
-		log.Println("sendSignedEos:", to, amountStr)
-		if to == "" || amountStr == "" || sig == "" {
+		log.Println("sendSignedEos:", to, r.Form.Get("amount"))
+		if sig == "" {
 			log.Println("parameters not enought")
 			RespondWithError(w, 400, "Missing some fields")
 			return
 		}
 
-		amount, ok := new(big.Int).SetString(RightShift(amountStr, 4), 10)
-		if !ok {
-			log.Println("invalid amount")
-			RespondWithError(w, 400, "Invalid amount")
-			return
-		}
-
-		if !VerifyAddress(config, to) {
-			log.Println("invalid to address:", to)
-			RespondWithError(w, 400, "invalid to address")
+		t, amount, err := TransferParams(config, client, r.Form.Get("symbol"), to, r.Form.Get("amount"))
+		if err != nil {
+			RespondWithError(w, errorCode(err), err.Error())
 			return
 		}
 
-		hash, err := SendSignedEosTx(config, to, amount.Int64(), memo, sig)
+		hash, expiration, err := SendSignedEosTx(config, client, t, to, amount.Int64(), memo, sig)
 		if err != nil {
 			log.Println("send tx err:", err)
 			RespondWithError(w, 500, fmt.Sprintf("send tx err: %v", err))
 			return
 		}
+		trackBroadcast(config, store, t, hash, to, LeftShift(amount.String(), t.Precision), memo, expiration)
 		Respond(w, 0, map[string]string{"hash": hash})
 	}
 }
 
-func CheckAddrHandler(config *Config) func(w http.ResponseWriter, r *http.Request) {
+func CheckAddrHandler(config *Config, client *ChainClient) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		addr := r.URL.Query().Get("address")
 		if addr == "" {
@@ -235,7 +177,7 @@ func CheckAddrHandler(config *Config) func(w http.ResponseWriter, r *http.Reques
 			return
 		}
 
-		ok := VerifyAddress(config, addr)
+		ok := VerifyAddress(client, addr)
 		if ok {
 			Respond(w, 0, map[string]string{"result": "valid"})
 		} else {
@@ -243,3 +185,195 @@ func CheckAddrHandler(config *Config) func(w http.ResponseWriter, r *http.Reques
 		}
 	}
 }
+
+func RPCStatusHandler(client *ChainClient) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endpoints, current := client.Pool().Status()
+		if len(endpoints) == 0 {
+			RespondWithError(w, 500, "no rpc endpoint configured")
+			return
+		}
+		Respond(w, 0, map[string]interface{}{
+			"current":   endpoints[current].URL,
+			"endpoints": endpoints,
+		})
+	}
+}
+
+func SecurityEventsHandler(store *Store) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := 100
+		if arg := r.URL.Query().Get("limit"); arg != "" {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n <= 0 {
+				RespondWithError(w, 400, "invalid limit")
+				return
+			}
+			limit = n
+		}
+
+		events, err := store.SecurityEvents(limit)
+		if err != nil {
+			log.Println("get security events err:", err)
+			RespondWithError(w, 500, fmt.Sprintf("could not get security events: %v", err))
+			return
+		}
+		Respond(w, 0, map[string]interface{}{"events": events})
+	}
+}
+
+func FailedTxsHandler(store *Store) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		account := r.URL.Query().Get("account")
+		tx := r.URL.Query().Get("tx")
+
+		txs, err := store.FailedTxs(account, tx)
+		if err != nil {
+			log.Println("get failed txs err:", err)
+			RespondWithError(w, 500, fmt.Sprintf("could not get failed txs: %v", err))
+			return
+		}
+		Respond(w, 0, map[string]interface{}{"txs": txs})
+	}
+}
+
+// maxRescanBlocks bounds a rescan asked over http, larger ranges go
+// through the rescan command.
+const maxRescanBlocks = 1000
+
+func RescanHandler(config *Config, source BlockSource, store *Store) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := &RescanRequest{TxIDs: splitList(r.URL.Query().Get("tx"))}
+		if len(req.TxIDs) == 0 {
+			var err error
+			if req.From, err = strconv.ParseUint(r.URL.Query().Get("from"), 10, 64); err != nil {
+				RespondWithError(w, 400, "invalid from")
+				return
+			}
+			req.To = req.From
+			if arg := r.URL.Query().Get("to"); arg != "" {
+				if req.To, err = strconv.ParseUint(arg, 10, 64); err != nil {
+					RespondWithError(w, 400, "invalid to")
+					return
+				}
+			}
+			if req.To >= req.From && req.To-req.From >= maxRescanBlocks {
+				RespondWithError(w, 400, fmt.Sprintf("at most %d blocks", maxRescanBlocks))
+				return
+			}
+		} else if len(req.TxIDs) > maxRescanBlocks {
+			RespondWithError(w, 400, fmt.Sprintf("at most %d transactions", maxRescanBlocks))
+			return
+		}
+
+		report, err := Rescan(config, source, store, req)
+		if err != nil {
+			log.Println("rescan err:", err)
+			RespondWithError(w, 500, fmt.Sprintf("could not rescan: %v", err))
+			return
+		}
+		Respond(w, 0, report)
+	}
+}
+
+func OutboxHandler(store *Store) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dead := r.URL.Query().Get("dead") == "1"
+		entries, err := store.OutboxEntries(dead)
+		if err != nil {
+			log.Println("get outbox err:", err)
+			RespondWithError(w, 500, fmt.Sprintf("could not get outbox: %v", err))
+			return
+		}
+		Respond(w, 0, map[string]interface{}{"entries": entries})
+	}
+}
+
+func OutboxReplayHandler(store *Store) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			RespondWithError(w, 400, "key is required")
+			return
+		}
+
+		found, err := store.Replay(key)
+		if err != nil {
+			log.Println("replay outbox err:", err)
+			RespondWithError(w, 500, fmt.Sprintf("could not replay: %v", err))
+			return
+		}
+		if !found {
+			RespondWithError(w, 404, "no such entry")
+			return
+		}
+		Respond(w, 0, map[string]interface{}{"key": key})
+	}
+}
+
+// InnerFeeHandler lists the fees reported, or with a hash queues a fee
+// entered by an operator.
+func InnerFeeHandler(config *Config, store *Store) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("account")
+		hash := r.URL.Query().Get("hash")
+		if hash == "" {
+			records, err := store.FeeRecords(name)
+			if err != nil {
+				log.Println("get fees err:", err)
+				RespondWithError(w, 500, fmt.Sprintf("could not get fees: %v", err))
+				return
+			}
+			Respond(w, 0, map[string]interface{}{"fees": records})
+			return
+		}
+
+		if name == "" {
+			name = config.Account
+		}
+		if config.Watched(name) == nil {
+			RespondWithError(w, 400, "unknown account")
+			return
+		}
+		// paid in the system token, as the resource costs
+		t := config.SystemToken()
+		value, err := t.ParseAmount(r.URL.Query().Get("fee"))
+		if err != nil {
+			RespondWithError(w, 400, "invalid fee")
+			return
+		}
+		fee := LeftShift(value.String(), t.Precision)
+
+		entry := &OutboxEntry{Kind: OUTBOX_FEE, Account: name, Hash: hash, Fee: fee, Manual: true}
+		if err := store.EnqueueEvent(config.AccountSinks(name), entry); err != nil {
+			log.Println("queue fee err:", err)
+			RespondWithError(w, 500, fmt.Sprintf("could not queue fee: %v", err))
+			return
+		}
+		log.Println("fee", fee, "of", hash, "for", name, "queued by operator")
+		Respond(w, 0, map[string]string{"hash": hash, "fee": fee})
+	}
+}
+
+func BroadcastsHandler(store *Store) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		broadcasts, err := store.Broadcasts(r.URL.Query().Get("status"))
+		if err != nil {
+			log.Println("get broadcasts err:", err)
+			RespondWithError(w, 500, fmt.Sprintf("could not get broadcasts: %v", err))
+			return
+		}
+		Respond(w, 0, map[string]interface{}{"broadcasts": broadcasts})
+	}
+}
+
+func TxStatusHandler(store *Store) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b, err := GetTxStatus(store, r.URL.Query().Get("hash"))
+		if err != nil {
+			RespondWithError(w, errorCode(err), err.Error())
+			return
+		}
+		Respond(w, 0, b)
+	}
+}
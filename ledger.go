@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	LEDGER_DEPOSIT  = "deposit"
+	LEDGER_WITHDRAW = "withdraw"
+	LEDGER_FEE      = "fee"
+)
+
+// Key is the unique key of a transfer: transaction id, action ordinal
+// and block number.
+func (m *NotifyMessage) Key() string {
+	return fmt.Sprintf("%s:%d:%d", m.TxHash, m.Ordinal, m.BlockNum)
+}
+
+// TransferID identifies a transfer whatever block holds it: transaction
+// id and action ordinal.
+func (m *NotifyMessage) TransferID() string {
+	return fmt.Sprintf("%s:%d", m.TxHash, m.Ordinal)
+}
+
+// LedgerEntry records a transfer delivered for a watched account.
+type LedgerEntry struct {
+	Key     string `json:"key"`
+	Account string `json:"account"`
+	Kind    string `json:"kind"`
+	Time    int64  `json:"time"`
+}
+
+// ledgerKey leaves the block number out, a transaction moved to another
+// block by a fork is still the same transfer.
+func ledgerKey(account string, kind string, message *NotifyMessage) string {
+	return fmt.Sprintf("%s/%s/%s", account, kind, message.TransferID())
+}
+
+// Delivered tells whether the transfer was already delivered for the
+// account, a ledger error counts as delivered so nothing is sent twice.
+func (s *Store) Delivered(account string, kind string, message *NotifyMessage) bool {
+	entry := new(LedgerEntry)
+	found, err := s.get(bucketLedger, []byte(ledgerKey(account, kind, message)), entry)
+	if err != nil {
+		log.Println("read ledger err:", err)
+		return true
+	}
+	if found {
+		log.Println(kind, "of", message.Key(), "for", account, "already delivered as", entry.Key)
+	}
+	return found
+}
+
+func (s *Store) RecordDelivery(account string, kind string, message *NotifyMessage) error {
+	entry := &LedgerEntry{Key: message.Key(), Account: account, Kind: kind, Time: time.Now().Unix()}
+	return s.put(bucketLedger, []byte(ledgerKey(account, kind, message)), entry)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -20,22 +21,43 @@ const (
 	NOTIFY_TYPE_NONE = iota
 	NOTIFY_TYPE_TX
 	NOTIFY_TYPE_ADMIN
+	NOTIFY_TYPE_PENDING
+	NOTIFY_TYPE_REVERT
+	NOTIFY_TYPE_FAILED
+	// the transfers up to a block of BlockTime were all delivered
+	NOTIFY_TYPE_CLOCK
 )
 
 type NotifyMessage struct {
 	MessageType int
 	AddressFrom string
 	AddressTo   string
+	Contract    string
+	Symbol      string
+	Precision   int
 	Amount      *big.Int
 	Memo        string
 	TxHash      string
 	BlockTime   int64
+	BlockNum    uint64
+	// action_ordinal of the transfer in its transaction
+	Ordinal uint32
+	// receipt status of a transaction which was not executed
+	Status string
+	// resources billed to the transaction, zero when unknown
+	CPUUsage uint32
+	NetUsage uint32
+	// transfers of the transaction, sharing its resources
+	TxTransfers uint32
+	// account notified of the transfer, empty when unknown
+	Receiver string
+	Cursor   *Cursor
 }
 
 var (
 	fDebug      bool
+	fRPCTrace   bool
 	fConfigFile string
-	packHash    string
 
 	buildVer  = false
 	commitID  string
@@ -44,9 +66,62 @@ var (
 
 func init() {
 	flag.BoolVar(&fDebug, "debug", true, "Debug")
+	flag.BoolVar(&fRPCTrace, "rpctrace", false, "Log the endpoint which served each rpc request")
 	flag.StringVar(&fConfigFile, "cfg", "config.ini", "Configuration file")
 	flag.BoolVar(&buildVer, "version", false, "print build version and then exit")
-	flag.StringVar(&packHash, "pack", "", "packet the hash to system")
+}
+
+// NewRouter returns the HTTP API of the wallet.
+func NewRouter(config *Config, client *ChainClient, source BlockSource, store *Store) *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/getMemo", GetMemoHandler(config))
+	r.HandleFunc("/getBalance", GetBalanceHandler(config, client))
+	r.HandleFunc("/sendEos", SendEosHandler(config, client, store))
+	r.HandleFunc("/prepareTrezorEosSign", PrepareTrezorEosSignHandler(config, client))
+	r.HandleFunc("/sendSignedEosTx", SendSignedEosTxHandler(config, client, store))
+	r.HandleFunc("/checkAddr", CheckAddrHandler(config, client))
+	r.HandleFunc("/rpcStatus", RPCStatusHandler(client))
+	r.HandleFunc("/securityEvents", SecurityEventsHandler(store))
+	r.HandleFunc("/failedTxs", FailedTxsHandler(store))
+	r.HandleFunc("/rescan", RescanHandler(config, source, store))
+	r.HandleFunc("/outbox", OutboxHandler(store))
+	r.HandleFunc("/outbox/replay", OutboxReplayHandler(store))
+	r.HandleFunc("/innerFee", InnerFeeHandler(config, store))
+	r.HandleFunc("/broadcasts", BroadcastsHandler(store))
+	r.HandleFunc("/txStatus", TxStatusHandler(store))
+
+	r.NotFoundHandler = http.HandlerFunc(NotFoundHandler)
+	return r
+}
+
+// StartPipeline starts the scan from the cursor, the notifier and the
+// outbox. The scanner of the blocks takes the chain head from the
+// returned channel.
+func StartPipeline(ctx context.Context, config *Config, source BlockSource, store *Store, security *SecurityLog, sinks map[string]DepositSink, cursor *Cursor) (chan ObjMessage, error) {
+	last_id := cursor.Number + 1
+	ch1 := make(chan NotifyMessage, 1024)
+	ch2 := make(chan ObjMessage, 1024)
+
+	go Notifier(config, store, security, ch1)
+	go NewOutbox(config, store, sinks).Run(ctx)
+	switch config.ScanMode {
+	case "actions":
+		history, err := NewActionHistory(config)
+		if err != nil {
+			return nil, err
+		}
+		positions, err := RestoreActionCursors(config, store, cursor)
+		if err != nil {
+			return nil, err
+		}
+		log.Println("last actions: ", positions)
+		go ActionListener(config, history, NewBroadcastClock(source, store), ch2, ch1, positions)
+	case "ship":
+		go ShipListener(config, ch1, last_id)
+	default:
+		go Listener(config, source, ch2, ch1, last_id)
+	}
+	return ch2, nil
 }
 
 func main() {
@@ -73,23 +148,55 @@ func main() {
 		panic(err)
 	}
 
-	last_id = config.LastBlock
+	client := NewChainClient(config)
+	client.Pool().Probe()
+	go client.Pool().Monitor(config.RPCProbeInterval)
 
-	r := mux.NewRouter()
-	r.HandleFunc("/getMemo", GetMemoHandler(config))
-	r.HandleFunc("/getBalance", GetBalanceHandler(config))
-	r.HandleFunc("/sendEos", SendEosHandler(config))
-	r.HandleFunc("/prepareTrezorEosSign", PrepareTrezorEosSignHandler(config))
-	r.HandleFunc("/sendSignedEosTx", SendSignedEosTxHandler(config))
-	r.HandleFunc("/checkAddr", CheckAddrHandler(config))
+	source, err := NewBlockSource(config, client)
+	if err != nil {
+		panic(err)
+	}
 
-	r.NotFoundHandler = http.HandlerFunc(NotFoundHandler)
+	store, err := OpenStore(config.StorePath)
+	if err != nil {
+		if flag.Arg(0) == "rescan" {
+			log.Println("open store err:", err, "(use /rescan while the wallet runs)")
+			os.Exit(1)
+		}
+		panic(err)
+	}
+	defer store.Close()
+
+	if flag.Arg(0) == "rescan" {
+		code := RescanCommand(config, source, store, flag.Args()[1:])
+		store.Close()
+		os.Exit(code)
+	}
+
+	cursor, err := RestoreCursor(config, store, source)
+	if err != nil {
+		panic(err)
+	}
+	last_id = cursor.Number + 1
+
+	r := NewRouter(config, client, source, store)
 	log.Println("last block: ", last_id)
 
-	ch1 := make(chan NotifyMessage, 1024)
-	ch2 := make(chan ObjMessage, 1024)
-	go Notifier(config, ch1)
-	go Listener(config, ch2, ch1, last_id)
+	security, err := NewSecurityLog(config, store)
+	if err != nil {
+		panic(err)
+	}
+	// cancelled on shutdown to give up the sink calls in progress
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sinks, err := NewDepositSinks(ctx, config)
+	if err != nil {
+		panic(err)
+	}
+	ch2, err := StartPipeline(ctx, config, source, store, security, sinks, cursor)
+	if err != nil {
+		panic(err)
+	}
 
 	host := ":" + strconv.FormatInt(int64(config.Port), 10)
 	log.Printf("Starting web server at %s ...\n", host)
@@ -107,8 +214,22 @@ func main() {
 	}
 	go server.Serve(listener)
 
+	var walletServer *WalletServer
+	if obj, ok := TarsServantObj(config); ok {
+		log.Printf("Starting wallet servant %s under the Tars node ...\n", obj)
+		walletServer = NewWalletServer(config, NewWalletServant(config, client, store))
+		walletServer.Start()
+	} else if config.ServantAddr != "" {
+		log.Printf("Starting wallet servant at %s ...\n", config.ServantAddr)
+		walletServer = NewWalletServer(config, NewWalletServant(config, client, store))
+		if err = walletServer.Start(); err != nil {
+			log.Println("listen servant err:", err)
+			return
+		}
+	}
+
 	//launch the signal once avoiding waiting for a long time
-	GetNewerBlock(config, ch2)
+	GetNewerBlock(source, ch2)
 
 	stop := 0
 	for {
@@ -120,11 +241,11 @@ func main() {
 			// stop all modules
 			//http.StopHttpService(serviceObj)
 			stop = 1
+			cancel()
 			break
 		case <-newBlockTicker.C:
-			SaveConfiguration(config, fConfigFile)
 			if len(ch2) == 0 {
-				GetNewerBlock(config, ch2)
+				GetNewerBlock(source, ch2)
 			}
 		}
 
@@ -133,6 +254,10 @@ func main() {
 		}
 	}
 	server.Close()
-	SaveConfiguration(config, fConfigFile)
+	if walletServer != nil {
+		shutdownCtx, done := context.WithTimeout(context.Background(), 5*time.Second)
+		walletServer.Shutdown(shutdownCtx)
+		done()
+	}
 	log.Println("bye")
 }
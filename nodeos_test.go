@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eoscanada/eos-go"
+	"github.com/eoscanada/eos-go/ecc"
+)
+
+// fakeNodeos answers the chain API of a nodeos from a scripted chain:
+// blocks and their forks, accounts, balances and failures. It also
+// answers get_required_keys with the keys it is given, for the signer.
+type fakeNodeos struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	chainID  eos.Checksum256
+	clock    time.Time
+	blocks   map[uint32]*eos.BlockResp
+	head     uint32
+	lib      uint32
+	accounts map[string]bool
+	balances map[string][]string
+	pushed   []*eos.PackedTransaction
+	mined    int
+	failures map[string]int
+	reject   string
+}
+
+func newFakeNodeos() *fakeNodeos {
+	chainID, _ := hex.DecodeString(testChainID)
+	n := &fakeNodeos{
+		chainID:  eos.Checksum256(chainID),
+		clock:    time.Now(),
+		blocks:   make(map[uint32]*eos.BlockResp),
+		accounts: make(map[string]bool),
+		balances: make(map[string][]string),
+		failures: make(map[string]int),
+	}
+	n.Server = httptest.NewServer(http.HandlerFunc(n.serve))
+	return n
+}
+
+func executedReceipt(packed *eos.PackedTransaction) eos.TransactionReceipt {
+	id, _ := packed.ID()
+	return eos.TransactionReceipt{
+		TransactionReceiptHeader: eos.TransactionReceiptHeader{Status: eos.TransactionStatusExecuted, CPUUsageMicroSeconds: 200, NetUsageWords: 16},
+		Transaction:              eos.TransactionWithID{ID: id, Packed: packed},
+	}
+}
+
+// AddBlock puts a block on top of block num-1, the blocks above are
+// dropped as by a fork. branch makes the block id differ between forks.
+func (n *fakeNodeos) AddBlock(num uint32, branch byte, receipts ...eos.TransactionReceipt) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.addBlock(num, branch, receipts)
+}
+
+func (n *fakeNodeos) addBlock(num uint32, branch byte, receipts []eos.TransactionReceipt) {
+	for above := num + 1; above <= n.head; above++ {
+		delete(n.blocks, above)
+	}
+
+	id := make(eos.Checksum256, 32)
+	binary.BigEndian.PutUint32(id, num)
+	id[4] = branch
+	block := &eos.BlockResp{ID: id, BlockNum: num}
+	if prev, ok := n.blocks[num-1]; ok {
+		block.Previous = prev.ID
+	}
+	n.clock = n.clock.Add(500 * time.Millisecond)
+	block.Timestamp = eos.BlockTimestamp{Time: n.clock.UTC().Truncate(500 * time.Millisecond)}
+	block.Transactions = receipts
+	block.ProducerSignature, _ = ecc.NewSignatureFromData(make([]byte, 66))
+
+	n.blocks[num] = block
+	n.head = num
+}
+
+// MineBlock includes the transactions pushed since the last one in a
+// block on the head and returns its number.
+func (n *fakeNodeos) MineBlock() uint32 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var receipts []eos.TransactionReceipt
+	for _, packed := range n.pushed[n.mined:] {
+		receipts = append(receipts, executedReceipt(packed))
+	}
+	n.mined = len(n.pushed)
+	n.addBlock(n.head+1, 0, receipts)
+	return n.head
+}
+
+// Drop forgets the transactions pushed since the last block, as when
+// they never reach a producer.
+func (n *fakeNodeos) Drop() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.mined = len(n.pushed)
+}
+
+func (n *fakeNodeos) SetLIB(num uint32) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.lib = num
+}
+
+// Advance moves the time of the next blocks.
+func (n *fakeNodeos) Advance(d time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.clock = n.clock.Add(d)
+}
+
+func (n *fakeNodeos) AddAccount(names ...string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, name := range names {
+		n.accounts[name] = true
+	}
+}
+
+// SetBalance sets the assets of an account, like "1.0000 EOS".
+func (n *fakeNodeos) SetBalance(account string, assets ...string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.balances[account] = assets
+}
+
+// Fail makes the next calls of an endpoint, like get_block, answer as a
+// broken proxy would.
+func (n *fakeNodeos) Fail(endpoint string, times int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.failures[endpoint] = times
+}
+
+// Reject makes the chain refuse the pushed transactions with a message,
+// empty to accept them again.
+func (n *fakeNodeos) Reject(message string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.reject = message
+}
+
+func (n *fakeNodeos) Pushed() []*eos.PackedTransaction {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]*eos.PackedTransaction(nil), n.pushed...)
+}
+
+func chainError(w http.ResponseWriter, code int, name string, message string) {
+	apiErr := eos.APIError{Code: 500, Message: "Internal Service Error"}
+	apiErr.ErrorStruct.Code = code
+	apiErr.ErrorStruct.Name = name
+	apiErr.ErrorStruct.What = message
+	apiErr.ErrorStruct.Details = []eos.APIErrorDetail{{Message: message}}
+	w.WriteHeader(500)
+	json.NewEncoder(w).Encode(apiErr)
+}
+
+// nodeosBlock returns a block as nodeos sends it, eos-go writes the
+// transactions in another form than it reads.
+func nodeosBlock(block *eos.BlockResp) interface{} {
+	data, _ := json.Marshal(block)
+	var out map[string]interface{}
+	json.Unmarshal(data, &out)
+	receipts, _ := out["transactions"].([]interface{})
+	for i, receipt := range block.Transactions {
+		trx := interface{}(receipt.Transaction.ID)
+		if receipt.Transaction.Packed != nil {
+			trx = []interface{}{1, receipt.Transaction.Packed}
+		}
+		receipts[i].(map[string]interface{})["trx"] = trx
+	}
+	return out
+}
+
+func (n *fakeNodeos) serve(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	endpoint := strings.TrimPrefix(r.URL.Path, "/v1/chain/")
+	if n.failures[endpoint] > 0 {
+		n.failures[endpoint]--
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+		return
+	}
+
+	var params map[string]json.RawMessage
+	json.NewDecoder(r.Body).Decode(&params)
+	param := func(name string) string {
+		var value string
+		if err := json.Unmarshal(params[name], &value); err != nil {
+			return strings.Trim(string(params[name]), `"`)
+		}
+		return value
+	}
+
+	var out interface{}
+	switch endpoint {
+	case "get_info":
+		head := n.blocks[n.head]
+		info := &eos.InfoResp{
+			ChainID:                  n.chainID,
+			HeadBlockNum:             n.head,
+			LastIrreversibleBlockNum: n.lib,
+			HeadBlockID:              head.ID,
+			HeadBlockTime:            head.Timestamp,
+		}
+		if lib, ok := n.blocks[n.lib]; ok {
+			info.LastIrreversibleBlockID = lib.ID
+		}
+		out = info
+	case "get_block":
+		num, _ := strconv.ParseUint(param("block_num_or_id"), 10, 32)
+		block, ok := n.blocks[uint32(num)]
+		if !ok {
+			chainError(w, 3100002, "unknown_block_exception", fmt.Sprintf("Could not find block: %d", num))
+			return
+		}
+		out = nodeosBlock(block)
+	case "get_account":
+		name := param("account_name")
+		if !n.accounts[name] {
+			chainError(w, 0, "exception", "unknown key (eosio::chain::name): "+name)
+			return
+		}
+		out = map[string]interface{}{"account_name": name}
+	case "get_currency_balance":
+		balances := n.balances[param("account")]
+		if balances == nil {
+			balances = []string{}
+		}
+		out = balances
+	case "get_required_keys":
+		out = map[string]json.RawMessage{"required_keys": params["available_keys"]}
+	case "push_transaction":
+		packed := new(eos.PackedTransaction)
+		data, _ := json.Marshal(params)
+		if err := json.Unmarshal(data, packed); err != nil {
+			chainError(w, 3010000, "packed_transaction_type_exception", err.Error())
+			return
+		}
+		if n.reject != "" {
+			chainError(w, 3050003, "eosio_assert_message_exception", n.reject)
+			return
+		}
+		n.pushed = append(n.pushed, packed)
+		id, _ := packed.ID()
+		out = map[string]interface{}{"transaction_id": id.String(), "processed": map[string]interface{}{"id": id.String()}}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	OUTBOX_DEPOSIT  = "deposit"
+	OUTBOX_WITHDRAW = "withdraw"
+	OUTBOX_FEE      = "fee"
+	// a broadcast withdrawal which expired or failed
+	OUTBOX_WITHDRAW_FAILED = "withdraw_failed"
+	// a delivered transfer dropped from the chain by a fork
+	OUTBOX_REVERT = "revert"
+)
+
+// OutboxEntry is an event for one sink kept until the sink accepts it.
+type OutboxEntry struct {
+	Key     string `json:"key"`
+	Sink    string `json:"sink,omitempty"`
+	Kind    string `json:"kind"`
+	Account string `json:"account"`
+	Symbol  string `json:"symbol"`
+	Hash    string `json:"hash"`
+	// TransferID of the transfer the event comes from
+	Transfer string `json:"transfer,omitempty"`
+	Ordinal  uint32 `json:"action_ordinal,omitempty"`
+	// kind of the event a revert takes back
+	Reverted string `json:"reverted,omitempty"`
+	// memo of a deposit, destination of a withdrawal
+	Addr   string `json:"addr"`
+	Amount string `json:"amount"`
+	Fee    string `json:"fee,omitempty"`
+	// source of a deposit
+	Deposit *DepositDetail `json:"deposit,omitempty"`
+	// end of a failed withdrawal
+	Status string `json:"status,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// submitted by an operator
+	Manual bool `json:"manual,omitempty"`
+	// answer of the sink to the last attempt
+	Response string `json:"response,omitempty"`
+
+	Created     int64  `json:"created"`
+	Attempts    int    `json:"attempts"`
+	NextAttempt int64  `json:"next_attempt"`
+	LastError   string `json:"last_error,omitempty"`
+	// an attempt was started, the sink may hold the event
+	Tried bool `json:"tried,omitempty"`
+}
+
+const (
+	CONFIRMATION_IRREVERSIBLE = "irreversible"
+	CONFIRMATION_BLOCKS       = "confirmed"
+)
+
+// DepositDetail is where a deposit comes from, for the sinks which can
+// take more than the memo.
+type DepositDetail struct {
+	Sender    string `json:"sender"`
+	Contract  string `json:"contract"`
+	Uid       uint64 `json:"uid"`
+	Memo      string `json:"memo"`
+	BlockNum  uint64 `json:"block_num"`
+	BlockTime int64  `json:"block_time"`
+	Ordinal   uint32 `json:"action_ordinal"`
+	// irreversible, or confirmed by a number of blocks
+	Confirmation string `json:"confirmation"`
+}
+
+// Enqueue writes the event to the outbox once for each sink and records
+// the transfer in the ledger in the same transaction, a transfer is
+// either queued and delivered or neither.
+func (s *Store) Enqueue(sinks []string, entry *OutboxEntry, ledger string, message *NotifyMessage) error {
+	entry.Created = time.Now().Unix()
+	delivery, err := json.Marshal(&LedgerEntry{Key: message.Key(), Account: entry.Account, Kind: ledger, Time: entry.Created})
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := enqueue(tx, sinks, entry); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketLedger).Put([]byte(ledgerKey(entry.Account, ledger, message)), delivery)
+	})
+}
+
+// EnqueueEvent writes an event which is not tied to a transfer, like a
+// fee submitted by an operator.
+func (s *Store) EnqueueEvent(sinks []string, entry *OutboxEntry) error {
+	entry.Created = time.Now().Unix()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return enqueue(tx, sinks, entry)
+	})
+}
+
+// eventID tells apart the events of one kind for an account: the
+// transfer they come from, else the hash. The fees of an operator have
+// their own namespace, they do not replace the fee of a transfer.
+func (e *OutboxEntry) eventID() string {
+	if e.Manual {
+		return "manual/" + e.Hash
+	}
+	if e.Transfer != "" {
+		return e.Transfer
+	}
+	return e.Hash
+}
+
+func outboxKey(sink string, entry *OutboxEntry) string {
+	return fmt.Sprintf("%s/%s/%s/%s", sink, entry.Account, entry.Kind, entry.eventID())
+}
+
+func enqueue(tx *bolt.Tx, sinks []string, entry *OutboxEntry) error {
+	for _, sink := range sinks {
+		sinkEntry := *entry
+		sinkEntry.Sink = sink
+		sinkEntry.Key = outboxKey(sink, entry)
+		data, err := json.Marshal(&sinkEntry)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(bucketOutbox).Put([]byte(sinkEntry.Key), data); err != nil {
+			return err
+		}
+		if entry.Kind == OUTBOX_FEE {
+			if err := putFeeRecord(tx, &sinkEntry, FEE_PENDING); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Revert takes back a transfer delivered for the account as ledger: the
+// entry leaves the ledger, the sinks which were never sent the event
+// lose it and the others, an attempt in flight or failed included, get
+// the revert event. It returns false if the transfer was not delivered.
+func (s *Store) Revert(sinks []string, entry *OutboxEntry, ledger string, message *NotifyMessage) (bool, error) {
+	entry.Created = time.Now().Unix()
+	reverted := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		key := []byte(ledgerKey(entry.Account, ledger, message))
+		if tx.Bucket(bucketLedger).Get(key) == nil {
+			return nil
+		}
+		reverted = true
+		if err := tx.Bucket(bucketLedger).Delete(key); err != nil {
+			return err
+		}
+
+		original := &OutboxEntry{Kind: ledger, Account: entry.Account, Transfer: entry.Transfer}
+		var delivered []string
+		for _, sink := range sinks {
+			key := []byte(outboxKey(sink, original))
+			queued, tried := false, false
+			for _, bucket := range [][]byte{bucketOutbox, bucketDead} {
+				queuedEntry, err := outboxEntry(tx, bucket, key)
+				if err != nil {
+					return err
+				}
+				if queuedEntry == nil {
+					continue
+				}
+				queued = true
+				tried = tried || queuedEntry.Tried
+				if err := tx.Bucket(bucket).Delete(key); err != nil {
+					return err
+				}
+			}
+			if !queued || tried {
+				delivered = append(delivered, sink)
+			}
+			if queued && ledger == LEDGER_FEE {
+				if err := tx.Bucket(bucketFees).Delete(key); err != nil {
+					return err
+				}
+			}
+		}
+		return enqueue(tx, delivered, entry)
+	})
+	return reverted, err
+}
+
+// OutboxEntries returns the entries of the outbox, or of the dead
+// letter queue.
+func (s *Store) OutboxEntries(dead bool) ([]OutboxEntry, error) {
+	bucket := bucketOutbox
+	if dead {
+		bucket = bucketDead
+	}
+
+	entries := []OutboxEntry{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(k, v []byte) error {
+			var entry OutboxEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	return entries, err
+}
+
+func outboxEntry(tx *bolt.Tx, bucket []byte, key []byte) (*OutboxEntry, error) {
+	data := tx.Bucket(bucket).Get(key)
+	if data == nil {
+		return nil, nil
+	}
+	entry := new(OutboxEntry)
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// claimOutbox marks the entry as tried before an attempt, a revert from
+// then on is sent to its sink. It returns false if the entry left the
+// outbox or was attempted since it was read.
+func (s *Store) claimOutbox(entry *OutboxEntry) (bool, error) {
+	claimed := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		current, err := outboxEntry(tx, bucketOutbox, []byte(entry.Key))
+		if err != nil || current == nil || current.Attempts != entry.Attempts {
+			return err
+		}
+		claimed = true
+		entry.Tried = true
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(bucketOutbox).Put([]byte(entry.Key), data)
+	})
+	return claimed, err
+}
+
+// updateOutbox stores the entry after an attempt: removed once sent,
+// moved to the dead letter queue when dead, else kept for a retry. The
+// record of a fee follows. Nothing is stored if a revert took the entry
+// out during the attempt.
+func (s *Store) updateOutbox(entry *OutboxEntry, sent bool, dead bool) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		outbox := tx.Bucket(bucketOutbox)
+		current, err := outboxEntry(tx, bucketOutbox, []byte(entry.Key))
+		if err != nil || current == nil || current.Attempts != entry.Attempts-1 {
+			return err
+		}
+		if entry.Kind == OUTBOX_FEE {
+			status := FEE_ACCEPTED
+			if dead {
+				status = FEE_DEAD
+			} else if !sent {
+				status = FEE_RETRYING
+			}
+			if err := putFeeRecord(tx, entry, status); err != nil {
+				return err
+			}
+		}
+		if sent || dead {
+			if err := outbox.Delete([]byte(entry.Key)); err != nil {
+				return err
+			}
+		}
+		if dead {
+			return tx.Bucket(bucketDead).Put([]byte(entry.Key), data)
+		}
+		if !sent {
+			return outbox.Put([]byte(entry.Key), data)
+		}
+		return nil
+	})
+}
+
+// Replay puts an entry of the dead letter queue back in the outbox, or
+// makes an entry of the outbox due now. It returns false if there is
+// no such entry.
+func (s *Store) Replay(key string) (bool, error) {
+	found := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		outbox := tx.Bucket(bucketOutbox)
+		dead := tx.Bucket(bucketDead)
+
+		data := outbox.Get([]byte(key))
+		fromDead := data == nil
+		if fromDead {
+			data = dead.Get([]byte(key))
+		}
+		if data == nil {
+			return nil
+		}
+		found = true
+
+		var entry OutboxEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		entry.NextAttempt = 0
+		if fromDead {
+			entry.Attempts = 0
+			if err := dead.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		data, err := json.Marshal(&entry)
+		if err != nil {
+			return err
+		}
+		return outbox.Put([]byte(key), data)
+	})
+	return found, err
+}
+
+// Outbox sends the queued events, retrying them with exponential
+// backoff until their sink accepts them.
+type Outbox struct {
+	config *Config
+	store  *Store
+	sinks  map[string]DepositSink
+}
+
+func NewOutbox(config *Config, store *Store, sinks map[string]DepositSink) *Outbox {
+	return &Outbox{config: config, store: store, sinks: sinks}
+}
+
+// Run flushes the outbox until ctx is cancelled.
+func (o *Outbox) Run(ctx context.Context) {
+	ticker := time.NewTicker(o.config.OutboxInterval)
+	defer ticker.Stop()
+
+	for {
+		o.Flush(time.Now())
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Flush makes the attempts due at now.
+func (o *Outbox) Flush(now time.Time) {
+	entries, err := o.store.OutboxEntries(false)
+	if err != nil {
+		log.Println("read outbox err:", err)
+		return
+	}
+
+	for i := range entries {
+		entry := &entries[i]
+		if entry.NextAttempt > now.Unix() {
+			continue
+		}
+
+		claimed, err := o.store.claimOutbox(entry)
+		if err != nil {
+			log.Println("claim outbox err:", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		entry.Response = ""
+		ok, err := o.send(entry)
+		entry.Attempts++
+		if err == nil && !ok {
+			err = fmt.Errorf("refused by the sink")
+		}
+		dead := false
+		if err != nil {
+			entry.LastError = err.Error()
+			entry.NextAttempt = now.Add(o.backoff(entry.Attempts)).Unix()
+			dead = entry.Attempts >= o.config.OutboxMaxAttempts
+			if dead {
+				log.Println("outbox:", entry.Key, "moved to dead letters after", entry.Attempts, "attempts, err:", err)
+			} else {
+				log.Println("outbox:", entry.Key, "attempt", entry.Attempts, "err:", err)
+			}
+		}
+		if err := o.store.updateOutbox(entry, err == nil, dead); err != nil {
+			log.Println("update outbox err:", err)
+		}
+	}
+}
+
+func (o *Outbox) backoff(attempts int) time.Duration {
+	delay := o.config.OutboxBackoff
+	for i := 1; i < attempts && delay < o.config.OutboxMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > o.config.OutboxMaxBackoff {
+		delay = o.config.OutboxMaxBackoff
+	}
+	return delay
+}
+
+func (o *Outbox) send(entry *OutboxEntry) (bool, error) {
+	name := entry.Sink
+	if name == "" {
+		// queued before the sinks were configurable
+		name = SINK_TARS
+	}
+	sink, ok := o.sinks[name]
+	if !ok {
+		return false, fmt.Errorf("sink %s is not enabled", name)
+	}
+	account := o.config.Watched(entry.Account)
+	if account == nil {
+		return false, fmt.Errorf("account %s is not watched", entry.Account)
+	}
+
+	switch entry.Kind {
+	case OUTBOX_DEPOSIT:
+		return sink.Deposit(account, entry)
+	case OUTBOX_WITHDRAW:
+		return sink.Withdraw(account, entry)
+	case OUTBOX_FEE:
+		return sink.Fee(account, entry)
+	case OUTBOX_WITHDRAW_FAILED:
+		return sink.WithdrawFailed(account, entry)
+	case OUTBOX_REVERT:
+		return sink.Revert(account, entry)
+	}
+	return false, fmt.Errorf("unknown event %s", entry.Kind)
+}
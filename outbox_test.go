@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testSink fails until up is set.
+type testSink struct {
+	up    bool
+	calls []string
+}
+
+func (s *testSink) send(entry *OutboxEntry) (bool, error) {
+	s.calls = append(s.calls, entry.Kind+" "+entry.Hash)
+	if !s.up {
+		return false, fmt.Errorf("freezing is down")
+	}
+	entry.Response = "ok " + entry.Hash
+	return true, nil
+}
+
+func (s *testSink) Deposit(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	return s.send(entry)
+}
+
+func (s *testSink) Withdraw(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	return s.send(entry)
+}
+
+func (s *testSink) Fee(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	return s.send(entry)
+}
+
+func (s *testSink) WithdrawFailed(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	return s.send(entry)
+}
+
+func (s *testSink) Revert(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	return s.send(entry)
+}
+
+func TestOutbox(t *testing.T) {
+	store, cleanup := openTestStore(t)
+	defer cleanup()
+
+	config := &Config{
+		Accounts:          []*WatchedAccount{{Name: "wallet"}},
+		OutboxBackoff:     time.Second,
+		OutboxMaxBackoff:  4 * time.Second,
+		OutboxMaxAttempts: 3,
+	}
+	message := &NotifyMessage{TxHash: "cc", Ordinal: 1, BlockNum: 10}
+	entry := &OutboxEntry{Kind: OUTBOX_DEPOSIT, Account: "wallet", Symbol: "EOS", Hash: message.TxHash, Transfer: message.TransferID(), Addr: "42", Amount: "1.0000"}
+	if err := store.Enqueue([]string{"test"}, entry, LEDGER_DEPOSIT, message); err != nil {
+		t.Fatal(err)
+	}
+	if !store.Delivered("wallet", LEDGER_DEPOSIT, message) {
+		t.Fatal("queued deposit not in the ledger")
+	}
+
+	sink := new(testSink)
+	outbox := NewOutbox(config, store, map[string]DepositSink{"test": sink})
+
+	now := time.Unix(1600000000, 0)
+	outbox.Flush(now)
+	// not due before the backoff
+	outbox.Flush(now)
+	outbox.Flush(now.Add(time.Second))
+	outbox.Flush(now.Add(3 * time.Second))
+	if len(sink.calls) != 3 {
+		t.Fatalf("got %d calls, want 3", len(sink.calls))
+	}
+
+	pending, _ := store.OutboxEntries(false)
+	dead, _ := store.OutboxEntries(true)
+	if len(pending) != 0 || len(dead) != 1 || dead[0].Attempts != 3 || dead[0].LastError != "freezing is down" {
+		t.Fatalf("unexpected outbox %+v, dead letters %+v", pending, dead)
+	}
+	if backoff := outbox.backoff(5); backoff != 4*time.Second {
+		t.Errorf("backoff is %v", backoff)
+	}
+
+	if found, err := store.Replay(dead[0].Key); !found || err != nil {
+		t.Fatalf("replay: %v %v", found, err)
+	}
+	sink.up = true
+	outbox.Flush(now.Add(4 * time.Second))
+	pending, _ = store.OutboxEntries(false)
+	dead, _ = store.OutboxEntries(true)
+	if len(sink.calls) != 4 || len(pending) != 0 || len(dead) != 0 {
+		t.Errorf("unexpected outbox %+v, dead letters %+v after %d calls", pending, dead, len(sink.calls))
+	}
+}
+
+func TestInternalTransferFee(t *testing.T) {
+	store, cleanup := openTestStore(t)
+	defer cleanup()
+
+	config := &Config{
+		Accounts:          []*WatchedAccount{{Name: "wallet"}, {Name: "exchange"}},
+		Tokens:            []*Token{EOSToken()},
+		Sinks:             []string{"test"},
+		OutboxMaxAttempts: 3,
+	}
+	message := &NotifyMessage{
+		MessageType: NOTIFY_TYPE_TX,
+		AddressFrom: "wallet",
+		AddressTo:   "exchange",
+		Contract:    "eosio.token",
+		Symbol:      "EOS",
+		Precision:   4,
+		Amount:      big.NewInt(10000),
+		TxHash:      "ee",
+		Ordinal:     1,
+	}
+	results := HandleTransfer(config, store, nil, message)
+	if len(results) != 2 || results[0].Result != RESULT_CREDITED || results[1].Result != RESULT_IGNORED {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	if results = HandleTransfer(config, store, nil, message); results[0].Result != RESULT_ALREADY_CREDITED {
+		t.Errorf("internal transfer reported twice: %+v", results)
+	}
+
+	sink := &testSink{up: true}
+	NewOutbox(config, store, map[string]DepositSink{"test": sink}).Flush(time.Now())
+	records, err := store.FeeRecords("wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.calls) != 1 || sink.calls[0] != "fee ee" {
+		t.Fatalf("unexpected calls %v", sink.calls)
+	}
+	if len(records) != 1 || records[0].Status != FEE_ACCEPTED || records[0].Response != "ok ee" || records[0].Fee != "0" {
+		t.Errorf("unexpected fee records %+v", records)
+	}
+}
+
+// TestOutboxKeys checks that the events of two transfers of one
+// transaction, and a fee of an operator, do not replace each other.
+func TestOutboxKeys(t *testing.T) {
+	store, cleanup := openTestStore(t)
+	defer cleanup()
+
+	config := &Config{
+		Accounts: []*WatchedAccount{{Name: "wallet"}, {Name: "exchange"}},
+		Tokens:   []*Token{EOSToken()},
+		Sinks:    []string{"test"},
+	}
+	transfer := func(to string, ordinal uint32) *NotifyMessage {
+		return &NotifyMessage{
+			MessageType: NOTIFY_TYPE_TX,
+			AddressFrom: "wallet",
+			AddressTo:   to,
+			Contract:    "eosio.token",
+			Symbol:      "EOS",
+			Precision:   4,
+			Amount:      big.NewInt(10000),
+			TxHash:      "ff",
+			Ordinal:     ordinal,
+		}
+	}
+	HandleTransfer(config, store, nil, transfer("alice", 1))
+	HandleTransfer(config, store, nil, transfer("bob", 2))
+	HandleTransfer(config, store, nil, transfer("exchange", 3))
+	manual := &OutboxEntry{Kind: OUTBOX_FEE, Account: "wallet", Hash: "ff", Fee: "0.0100", Manual: true}
+	if err := store.EnqueueEvent(config.Sinks, manual); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ := store.OutboxEntries(false)
+	if len(entries) != 4 {
+		t.Fatalf("unexpected outbox %+v", entries)
+	}
+	if records, _ := store.FeeRecords("wallet"); len(records) != 2 {
+		t.Errorf("unexpected fee records %+v", records)
+	}
+}
+
+// revertingSink reverts the transfer while its event is being sent, as
+// the notifier may while the outbox waits for the sink.
+type revertingSink struct {
+	testSink
+	revert func()
+}
+
+func (s *revertingSink) Deposit(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	if s.revert != nil {
+		s.revert()
+		s.revert = nil
+	}
+	return s.send(entry)
+}
+
+// TestOutboxRevertInFlight checks that a revert during an attempt is
+// not undone by its end, and reaches the sink whatever the attempt gave.
+func TestOutboxRevertInFlight(t *testing.T) {
+	config := &Config{Accounts: []*WatchedAccount{{Name: "wallet"}}, OutboxBackoff: time.Second, OutboxMaxBackoff: time.Second, OutboxMaxAttempts: 3}
+	for _, up := range []bool{false, true} {
+		store, cleanup := openTestStore(t)
+		message := &NotifyMessage{TxHash: "cc", Ordinal: 1, BlockNum: 10}
+		entry := &OutboxEntry{Kind: OUTBOX_DEPOSIT, Account: "wallet", Symbol: "EOS", Hash: message.TxHash, Transfer: message.TransferID(), Addr: "42", Amount: "1.0000"}
+		if err := store.Enqueue([]string{"test"}, entry, LEDGER_DEPOSIT, message); err != nil {
+			t.Fatal(err)
+		}
+
+		sink := &revertingSink{testSink: testSink{up: up}}
+		sink.revert = func() {
+			revert := &OutboxEntry{Kind: OUTBOX_REVERT, Account: "wallet", Symbol: "EOS", Hash: message.TxHash, Transfer: message.TransferID(), Reverted: LEDGER_DEPOSIT, Addr: "42", Amount: "1.0000"}
+			if reverted, err := store.Revert([]string{"test"}, revert, LEDGER_DEPOSIT, message); !reverted || err != nil {
+				t.Fatalf("revert: %v %v", reverted, err)
+			}
+		}
+		outbox := NewOutbox(config, store, map[string]DepositSink{"test": sink})
+		outbox.Flush(time.Unix(1600000000, 0))
+
+		pending, _ := store.OutboxEntries(false)
+		if len(pending) != 1 || pending[0].Kind != OUTBOX_REVERT {
+			t.Fatalf("up %v: unexpected outbox %+v", up, pending)
+		}
+		sink.up = true
+		outbox.Flush(time.Unix(1600000010, 0))
+		if len(sink.calls) != 2 || sink.calls[1] != OUTBOX_REVERT+" cc" {
+			t.Errorf("up %v: unexpected sink calls %v", up, sink.calls)
+		}
+		cleanup()
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+// ScannedBlock is a block that has been read by the scanner. Sent
+// remembers, by transaction id, which notification type has already
+// been delivered for the transfers of the block. Failed holds the
+// transfers of the transactions which failed or expired.
+type ScannedBlock struct {
+	Number   uint64
+	ID       string
+	Previous string
+	Time     int64
+	Txns     []NotifyMessage
+	Failed   []NotifyMessage
+	Sent     map[string]int
+}
+
+// PendingBlocks keeps the blocks which are not final yet under the
+// configured confirmation policy, in ascending block order.
+type PendingBlocks struct {
+	blocks []*ScannedBlock
+}
+
+func (p *PendingBlocks) Push(block *ScannedBlock) {
+	p.blocks = append(p.blocks, block)
+}
+
+// PopConfirmed removes and returns the blocks at or below height.
+func (p *PendingBlocks) PopConfirmed(height uint64) []*ScannedBlock {
+	n := 0
+	for n < len(p.blocks) && p.blocks[n].Number <= height {
+		n++
+	}
+
+	confirmed := p.blocks[:n]
+	p.blocks = p.blocks[n:]
+	return confirmed
+}
+
+// Truncate drops the blocks above height.
+func (p *PendingBlocks) Truncate(height uint64) {
+	n := len(p.blocks)
+	for n > 0 && p.blocks[n-1].Number > height {
+		n--
+	}
+	p.blocks = p.blocks[:n]
+}
+
+func (p *PendingBlocks) Len() int {
+	return len(p.blocks)
+}
+
+// ConfirmedHeight returns the highest block number that is final
+// for the configured confirmation policy.
+func ConfirmedHeight(config *Config, head uint64, lib uint64) uint64 {
+	if config.ConfirmPolicy == CONFIRM_BLOCKS {
+		if head < config.ConfirmBlocks {
+			return 0
+		}
+		return head - config.ConfirmBlocks
+	}
+
+	// both lib and instant wait for the last irreversible block
+	return lib
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+)
+
+// RescanRequest is a range of blocks, or a list of transactions whose
+// blocks are looked up, to read again.
+type RescanRequest struct {
+	From  uint64
+	To    uint64
+	TxIDs []string
+}
+
+// RescanTransfer is a transfer found by a rescan with what became of it.
+type RescanTransfer struct {
+	TxHash   string `json:"tx_hash"`
+	Ordinal  uint32 `json:"ordinal"`
+	BlockNum uint64 `json:"block_num"`
+	Status   string `json:"status,omitempty"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Contract string `json:"contract"`
+	Symbol   string `json:"symbol"`
+	Amount   string `json:"amount"`
+	Memo     string `json:"memo"`
+	TransferResult
+}
+
+type RescanReport struct {
+	Blocks          []uint64         `json:"blocks"`
+	Transfers       []RescanTransfer `json:"transfers"`
+	Credited        int              `json:"credited"`
+	AlreadyCredited int              `json:"already_credited"`
+	// transactions which could not be looked up
+	Unresolved []string `json:"unresolved,omitempty"`
+}
+
+// blocks returns the block numbers to read and the transactions to keep
+// in them, all of them if the set is nil.
+func (req *RescanRequest) blocks(source BlockSource, report *RescanReport) ([]uint64, map[string]bool, error) {
+	if len(req.TxIDs) == 0 {
+		if req.From == 0 || req.To < req.From {
+			return nil, nil, fmt.Errorf("invalid block range %d-%d", req.From, req.To)
+		}
+		var numbers []uint64
+		for n := req.From; n <= req.To; n++ {
+			numbers = append(numbers, n)
+		}
+		return numbers, nil, nil
+	}
+
+	lookup, ok := source.(TransactionSource)
+	if !ok {
+		return nil, nil, fmt.Errorf("the block source can not look transactions up")
+	}
+	wanted := make(map[string]bool)
+	seen := make(map[uint64]bool)
+	var numbers []uint64
+	for _, id := range req.TxIDs {
+		tx, err := lookup.TransactionByID(id)
+		if err != nil {
+			log.Println("rescan: look up tx", id, "err:", err)
+			report.Unresolved = append(report.Unresolved, id)
+			continue
+		}
+		wanted[tx.ID.String()] = true
+		if !seen[uint64(tx.BlockNum)] {
+			seen[uint64(tx.BlockNum)] = true
+			numbers = append(numbers, uint64(tx.BlockNum))
+		}
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return numbers, wanted, nil
+}
+
+// Rescan reads blocks again and hands their transfers to the notifier
+// logic, the ledger keeps the deposits already credited from being sent
+// twice. The scan cursor is left alone and only irreversible blocks are
+// read. Rejected transfers are not reported to security again.
+func Rescan(config *Config, source BlockSource, store *Store, req *RescanRequest) (*RescanReport, error) {
+	report := &RescanReport{Transfers: []RescanTransfer{}}
+	numbers, wanted, err := req.blocks(source, report)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := source.HeadInfo()
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range numbers {
+		if n > uint64(info.LastIrreversibleBlockNum) {
+			return nil, fmt.Errorf("block %d is above the last irreversible block %d", n, info.LastIrreversibleBlockNum)
+		}
+	}
+
+	for _, n := range numbers {
+		block, err := ReadBlock(source, new(big.Int).SetUint64(n))
+		if err != nil {
+			return nil, err
+		}
+		report.Blocks = append(report.Blocks, n)
+
+		for _, txn := range block.Txns {
+			txn.MessageType = NOTIFY_TYPE_TX
+			report.add(config, store, wanted, &txn)
+		}
+		for _, txn := range block.Failed {
+			txn.MessageType = NOTIFY_TYPE_FAILED
+			report.add(config, store, wanted, &txn)
+		}
+	}
+	return report, nil
+}
+
+func (report *RescanReport) add(config *Config, store *Store, wanted map[string]bool, message *NotifyMessage) {
+	if wanted != nil && !wanted[message.TxHash] {
+		return
+	}
+
+	for _, result := range HandleTransfer(config, store, nil, message) {
+		report.Transfers = append(report.Transfers, RescanTransfer{
+			TxHash:         message.TxHash,
+			Ordinal:        message.Ordinal,
+			BlockNum:       message.BlockNum,
+			Status:         message.Status,
+			From:           message.AddressFrom,
+			To:             message.AddressTo,
+			Contract:       message.Contract,
+			Symbol:         message.Symbol,
+			Amount:         LeftShift(message.Amount.String(), message.Precision),
+			Memo:           message.Memo,
+			TransferResult: result,
+		})
+		switch result.Result {
+		case RESULT_CREDITED:
+			report.Credited++
+		case RESULT_ALREADY_CREDITED:
+			report.AlreadyCredited++
+		}
+	}
+}
+
+// RescanCommand runs the rescan subcommand and prints the report, it
+// returns the exit code.
+func RescanCommand(config *Config, source BlockSource, store *Store, args []string) int {
+	fs := flag.NewFlagSet("rescan", flag.ContinueOnError)
+	from := fs.Uint64("from", 0, "first block to read")
+	to := fs.Uint64("to", 0, "last block to read, from if not set")
+	txs := fs.String("tx", "", "comma separated transaction ids to read instead of a range")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	req := &RescanRequest{From: *from, To: *to, TxIDs: splitList(*txs)}
+	if req.To == 0 {
+		req.To = req.From
+	}
+
+	report, err := Rescan(config, source, store, req)
+	if err != nil {
+		log.Println("rescan err:", err)
+		return 1
+	}
+	out := json.NewEncoder(os.Stdout)
+	out.SetIndent("", "  ")
+	out.Encode(report)
+	return 0
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/eoscanada/eos-go"
+)
+
+func TestRescan(t *testing.T) {
+	store, cleanup := openTestStore(t)
+	defer cleanup()
+
+	config := &Config{
+		Account:  "wallet",
+		Accounts: []*WatchedAccount{{Name: "wallet", MemoScheme: MEMO_SCHEME_UID}},
+		Tokens:   []*Token{EOSToken()},
+	}
+	credited := testTransfer(t, "alice", "wallet", 10000, "42")
+	unknown := testTransfer(t, "bob", "wallet", 10000, "nobody")
+	unknownID, _ := unknown.ID()
+
+	chain := newTestChain()
+	chain.add(1, 0)
+	chain.add(2, 0, credited, unknown)
+	chain.add(3, 0)
+	chain.add(4, 0)
+	chain.source.SetIrreversible(3)
+	chain.source.PutTransaction(&eos.TransactionResp{ID: unknownID, BlockNum: 2})
+
+	// the deposit was credited by the live scan
+	block, _ := ReadBlock(chain.source, big.NewInt(2))
+	if err := store.RecordDelivery("wallet", LEDGER_DEPOSIT, &block.Txns[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Rescan(config, chain.source, store, &RescanRequest{From: 1, To: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Blocks) != 3 || len(report.Transfers) != 2 || report.AlreadyCredited != 1 || report.Credited != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report.Transfers[1].Memo != "nobody" || report.Transfers[1].Result != RESULT_IGNORED {
+		t.Errorf("unexpected transfer %+v", report.Transfers[1])
+	}
+
+	report, err = Rescan(config, chain.source, store, &RescanRequest{TxIDs: []string{unknownID.String(), "00ff"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Transfers) != 1 || report.Transfers[0].TxHash != unknownID.String() || len(report.Unresolved) != 1 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	if _, err = Rescan(config, chain.source, store, &RescanRequest{From: 3, To: 4}); err == nil {
+		t.Error("rescan of a reversible block")
+	}
+	if cursor, _ := store.LoadCursor(); cursor != nil {
+		t.Errorf("rescan saved cursor %+v", cursor)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+)
+
+// MinerCost is the price of the CPU and NET a transaction was billed,
+// in the system token, "0" when the usage or the prices are unknown.
+// shareResources tells the transfers read from one transaction how
+// many transfers it holds.
+func shareResources(msgs []NotifyMessage, transfers int) {
+	for i := range msgs {
+		msgs[i].TxTransfers = uint32(transfers)
+	}
+}
+
+func MinerCost(config *Config, message *NotifyMessage) string {
+	cost := new(big.Rat)
+	if config.CPUPrice != nil {
+		// cpu_usage_us, priced by ms
+		cpu := new(big.Rat).SetFrac64(int64(message.CPUUsage), 1000)
+		cost.Add(cost, cpu.Mul(cpu, config.CPUPrice))
+	}
+	if config.NetPrice != nil {
+		// net_usage_words are 8 bytes, priced by KiB
+		net := new(big.Rat).SetFrac64(int64(message.NetUsage)*8, 1024)
+		cost.Add(cost, net.Mul(net, config.NetPrice))
+	}
+
+	// each transfer of the transaction reports its share
+	if message.TxTransfers > 1 {
+		cost.Quo(cost, new(big.Rat).SetInt64(int64(message.TxTransfers)))
+	}
+
+	s := cost.FloatString(config.CostPrecision)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/eoscanada/eos-go"
+	"github.com/eoscanada/eos-go/token"
+)
+
+func TestMinerCost(t *testing.T) {
+	config := &Config{CPUPrice: big.NewRat(1, 10000), NetPrice: big.NewRat(2, 10000), CostPrecision: 8}
+	// 250us of CPU and 16 words of NET: 0.25ms and 0.125KiB
+	message := &NotifyMessage{CPUUsage: 250, NetUsage: 16}
+	if cost := MinerCost(config, message); cost != "0.00005" {
+		t.Errorf("cost is %s, want 0.00005", cost)
+	}
+
+	config.CostPrecision = 4
+	if cost := MinerCost(config, message); cost != "0.0001" {
+		t.Errorf("rounded cost is %s, want 0.0001", cost)
+	}
+	if cost := MinerCost(&Config{}, message); cost != "0" {
+		t.Errorf("cost without prices is %s", cost)
+	}
+
+	// a transfer reports its share of the transaction
+	config.CostPrecision = 8
+	message.TxTransfers = 2
+	if cost := MinerCost(config, message); cost != "0.000025" {
+		t.Errorf("shared cost is %s, want 0.000025", cost)
+	}
+}
+
+func TestTransactionTransfers(t *testing.T) {
+	tx := eos.NewTransaction([]*eos.Action{
+		token.NewTransfer("wallet", "bob", eos.NewEOSAsset(10000), ""),
+		token.NewTransfer("wallet", "carol", eos.NewEOSAsset(20000), ""),
+	}, &eos.TxOptions{HeadBlockID: make(eos.Checksum256, 32)})
+	packed, err := eos.NewSignedTransaction(tx).Pack(eos.CompressionNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := newTestChain()
+	chain.add(1, 0, packed, testTransfer(t, "wallet", "dave", 30000, ""))
+
+	block, err := ReadBlock(chain.source, big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(block.Txns) != 3 || block.Txns[0].TxTransfers != 2 || block.Txns[1].TxTransfers != 2 || block.Txns[2].TxTransfers != 1 {
+		t.Fatalf("unexpected transfers %+v", block.Txns)
+	}
+}
+
+func TestCostPrecision(t *testing.T) {
+	resources := "\n[resources]\ncpu_price = 0.0001\nnet_price = 0.0002\n"
+	config, err := loadTestConfig(t, testAccountsConfig+resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// rounded to the 4 decimals of EOS
+	if cost := MinerCost(config, &NotifyMessage{CPUUsage: 250, NetUsage: 16}); config.CostPrecision != 4 || cost != "0.0001" {
+		t.Errorf("cost is %s at precision %d, want 0.0001 at 4", cost, config.CostPrecision)
+	}
+
+	if _, err = loadTestConfig(t, testAccountsConfig+resources+"precision = 8\n"); err == nil {
+		t.Error("precision finer than EOS accepted")
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/eoscanada/eos-go"
+)
+
+var errNoEndpoint = errors.New("no rpc endpoint configured")
+
+// RPCEndpoint is a nodeos of the pool and the result of its last probe.
+type RPCEndpoint struct {
+	URL       string    `json:"url"`
+	Healthy   bool      `json:"healthy"`
+	HeadBlock uint32    `json:"head_block"`
+	HeadTime  time.Time `json:"head_time"`
+	LastError string    `json:"last_error,omitempty"`
+	Served    uint64    `json:"served"`
+
+	api *eos.API
+}
+
+// RPCPool sends the chain API calls to one of several nodeos. The
+// endpoint in use is kept until it fails or a probe finds it unhealthy,
+// then the next healthy one takes over.
+type RPCPool struct {
+	chainID string
+	maxLag  time.Duration
+
+	mu        sync.Mutex
+	endpoints []*RPCEndpoint
+	current   int
+}
+
+func NewRPCPool(config *Config) *RPCPool {
+	pool := &RPCPool{chainID: config.EosChainID, maxLag: config.RPCMaxLag}
+
+	var signer eos.Signer
+	if config.Xpriv != "" {
+		wif, _ := ExtractPrivPubKey(config.Xpriv, 0)
+		keyBag := eos.NewKeyBag()
+		if err := keyBag.Add(wif); err != nil {
+			log.Println("load signing key err:", err)
+		}
+		signer = keyBag
+	}
+
+	client := NewHTTPClient(config.RPCTimeout)
+	for _, url := range config.RPCURLs {
+		api := eos.New(url)
+		api.HttpClient = client
+		if signer != nil {
+			api.SetSigner(signer)
+		}
+		pool.endpoints = append(pool.endpoints, &RPCEndpoint{URL: url, Healthy: true, api: api})
+	}
+	return pool
+}
+
+// Status returns a copy of the endpoints and the index of the one in use.
+func (p *RPCPool) Status() ([]RPCEndpoint, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := make([]RPCEndpoint, len(p.endpoints))
+	for i, endpoint := range p.endpoints {
+		status[i] = *endpoint
+		status[i].api = nil
+	}
+	return status, p.current
+}
+
+// Probe checks every endpoint: it must answer get_info for the expected
+// chain with a head block not older than the allowed lag.
+func (p *RPCPool) Probe() {
+	for i, endpoint := range p.endpoints {
+		info, err := endpoint.api.GetInfo()
+
+		p.mu.Lock()
+		if err == nil {
+			endpoint.HeadBlock = uint32(info.HeadBlockNum)
+			endpoint.HeadTime = info.HeadBlockTime.Time
+			if p.chainID != "" && info.ChainID.String() != p.chainID {
+				err = errors.New("chain id " + info.ChainID.String() + " does not match")
+			} else if p.maxLag > 0 && time.Since(endpoint.HeadTime) > p.maxLag {
+				err = errors.New("head block is behind since " + endpoint.HeadTime.UTC().Format(time.RFC3339))
+			}
+		}
+		if err != nil {
+			p.fail(i, err)
+		} else {
+			if !endpoint.Healthy {
+				log.Println("rpc endpoint", endpoint.URL, "is back")
+			}
+			endpoint.Healthy = true
+			endpoint.LastError = ""
+		}
+		p.mu.Unlock()
+	}
+}
+
+// Monitor probes the endpoints every interval, it never returns.
+func (p *RPCPool) Monitor(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		p.Probe()
+	}
+}
+
+// Call runs a read-only request, an endpoint which can't be reached is
+// marked unhealthy and the request is tried again on the next one.
+func (p *RPCPool) Call(name string, fn func(api *eos.API) error) error {
+	var err error = &TransportError{Err: errNoEndpoint}
+	for _, i := range p.order() {
+		err = p.do(i, name, fn)
+		if _, ok := err.(*TransportError); !ok {
+			return err
+		}
+	}
+	return err
+}
+
+// Send runs a request which must not be repeated, like a push of a
+// transaction, on the endpoint in use only.
+func (p *RPCPool) Send(name string, fn func(api *eos.API) error) error {
+	order := p.order()
+	if len(order) == 0 {
+		return &TransportError{Err: errNoEndpoint}
+	}
+	err := p.do(order[0], name, fn)
+	// the endpoint of a push is always told, a transaction is looked for
+	// where it was sent
+	if _, ok := err.(*TransportError); !ok && !fRPCTrace {
+		log.Println("rpc", name, "sent to", p.endpoints[order[0]].URL)
+	}
+	return err
+}
+
+// order lists the endpoints to try: the one in use, the other healthy
+// ones and then the unhealthy ones in case they came back.
+func (p *RPCPool) order() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var healthy, unhealthy []int
+	for n := range p.endpoints {
+		i := (p.current + n) % len(p.endpoints)
+		if p.endpoints[i].Healthy {
+			healthy = append(healthy, i)
+		} else {
+			unhealthy = append(unhealthy, i)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+func (p *RPCPool) do(i int, name string, fn func(api *eos.API) error) error {
+	endpoint := p.endpoints[i]
+	err := fn(endpoint.api)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if isEndpointFailure(err) {
+		log.Println("rpc", name, "on", endpoint.URL, "err:", err)
+		p.fail(i, err)
+		return &TransportError{Endpoint: endpoint.URL, Err: err}
+	}
+
+	// an unhealthy endpoint comes back through the probe only
+	endpoint.Served++
+	if p.current != i && endpoint.Healthy && !p.endpoints[p.current].Healthy {
+		log.Println("rpc switch to", endpoint.URL)
+		p.current = i
+	}
+	if fRPCTrace {
+		log.Println("rpc", name, "served by", endpoint.URL)
+	}
+	if err != nil {
+		return &ChainError{Endpoint: endpoint.URL, Err: err}
+	}
+	return nil
+}
+
+// fail marks the endpoint unhealthy and moves away from it if it is in
+// use. p.mu must be held.
+func (p *RPCPool) fail(i int, err error) {
+	endpoint := p.endpoints[i]
+	if endpoint.Healthy {
+		log.Println("rpc endpoint", endpoint.URL, "is unhealthy:", err)
+	}
+	endpoint.Healthy = false
+	endpoint.LastError = err.Error()
+	if i != p.current {
+		return
+	}
+
+	for n := 1; n < len(p.endpoints); n++ {
+		next := (i + n) % len(p.endpoints)
+		if p.endpoints[next].Healthy {
+			log.Println("rpc switch to", p.endpoints[next].URL)
+			p.current = next
+			return
+		}
+	}
+}
+
+// isEndpointFailure tells whether the error comes from the endpoint
+// itself rather than from the chain answering the request.
+func isEndpointFailure(err error) bool {
+	if err == nil || err == eos.ErrNotFound {
+		return false
+	}
+	switch err.(type) {
+	case eos.APIError, *eos.APIError:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eoscanada/eos-go"
+)
+
+const testChainID = "aca376f206b8fc25a6ed44dbdc66547c36c6c33e3a119ffbeaef943642f0e906"
+
+func newInfoServer(chainID string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/get_info") {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"chain_id":        chainID,
+			"head_block_num":  100,
+			"head_block_time": time.Now().UTC().Format("2006-01-02T15:04:05.000"),
+		})
+	}))
+}
+
+func getInfo(api *eos.API) error {
+	_, err := api.GetInfo()
+	return err
+}
+
+func TestRPCPoolFailover(t *testing.T) {
+	down := newInfoServer(testChainID)
+	down.Close()
+	up := newInfoServer(testChainID)
+	defer up.Close()
+
+	pool := NewRPCPool(&Config{RPCURLs: []string{down.URL, up.URL}, EosChainID: testChainID, RPCMaxLag: time.Minute})
+
+	// a write is not repeated elsewhere
+	if err := pool.Send("get_info", getInfo); err == nil {
+		t.Fatal("send on the closed endpoint succeeded")
+	}
+	if err := pool.Call("get_info", getInfo); err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints, current := pool.Status()
+	if endpoints[current].URL != up.URL || endpoints[0].Healthy || endpoints[1].Served != 1 {
+		t.Fatalf("unexpected status %+v, current %d", endpoints, current)
+	}
+
+	// the pool sticks to the endpoint in use when the other comes back
+	pool.endpoints[0].Healthy = true
+	if err := pool.Send("get_info", getInfo); err != nil {
+		t.Fatal(err)
+	}
+	if endpoints, current = pool.Status(); current != 1 || endpoints[1].Served != 2 {
+		t.Fatalf("unexpected status %+v, current %d", endpoints, current)
+	}
+}
+
+func TestRPCPoolProbe(t *testing.T) {
+	other := newInfoServer(strings.Repeat("0", 64))
+	defer other.Close()
+	good := newInfoServer(testChainID)
+	defer good.Close()
+
+	pool := NewRPCPool(&Config{RPCURLs: []string{other.URL, good.URL}, EosChainID: testChainID, RPCMaxLag: time.Minute})
+	pool.Probe()
+
+	endpoints, current := pool.Status()
+	if current != 1 || endpoints[0].Healthy || !endpoints[1].Healthy || endpoints[1].HeadBlock != 100 {
+		t.Fatalf("unexpected status %+v, current %d", endpoints, current)
+	}
+}
+
+func TestChainClientErrors(t *testing.T) {
+	down := newInfoServer(testChainID)
+	down.Close()
+	up := newInfoServer(testChainID)
+	defer up.Close()
+
+	client := NewChainClient(&Config{RPCURLs: []string{down.URL}, RPCRetries: 2, RPCBackoff: time.Millisecond})
+	if _, err := client.GetInfo(); err == nil {
+		t.Fatal("get info on a closed endpoint succeeded")
+	} else if _, ok := err.(*TransportError); !ok {
+		t.Fatalf("unexpected error %T: %v", err, err)
+	}
+
+	client = NewChainClient(&Config{RPCURLs: []string{up.URL}})
+	if _, err := client.GetInfo(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := client.GetBlockByNum(1)
+	if chainErr, ok := err.(*ChainError); !ok || chainErr.Err != eos.ErrNotFound || chainErr.Endpoint != up.URL {
+		t.Fatalf("unexpected error %T: %v", err, err)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"log"
+	"math/big"
+)
+
+// Scanner reads blocks in order, holds them until they are final and
+// watches the block ids for a switch of the chain to another branch.
+type Scanner struct {
+	config  *Config
+	source  BlockSource
+	fetcher *BlockFetcher
+	notify  chan<- NotifyMessage
+	next    uint64
+	pending *PendingBlocks
+	// last irreversible block, saved with the cursor
+	lib uint64
+	// recently read blocks which are not irreversible yet
+	recent map[uint64]*ScannedBlock
+
+	// transfers already delivered from blocks dropped by a fork, they
+	// are reverted unless the new branch includes them again before
+	// reaching orphanTip
+	orphans    []NotifyMessage
+	orphanSent map[string]int
+	orphanTip  uint64
+}
+
+func NewScanner(config *Config, source BlockSource, notify chan<- NotifyMessage, next uint64) *Scanner {
+	return &Scanner{
+		config:     config,
+		source:     source,
+		fetcher:    NewBlockFetcher(source, config.FetchWorkers),
+		notify:     notify,
+		next:       next,
+		pending:    new(PendingBlocks),
+		recent:     make(map[uint64]*ScannedBlock),
+		orphanSent: make(map[string]int),
+	}
+}
+
+// Next returns the number of the next block to read.
+func (s *Scanner) Next() uint64 {
+	return s.next
+}
+
+// Recent returns the ids of the blocks read which are not
+// irreversible yet, by block number.
+func (s *Scanner) Recent() map[uint64]string {
+	ids := make(map[uint64]string)
+	for number, block := range s.recent {
+		ids[number] = block.ID
+	}
+	return ids
+}
+
+// Scan reads the blocks up to head and delivers the ones which became
+// final.
+func (s *Scanner) Scan(head uint64, lib uint64) {
+	s.lib = lib
+	confirmed := ConfirmedHeight(s.config, head, lib)
+
+	for s.next <= head {
+		if !s.scanRange(head, lib, confirmed) {
+			break
+		}
+	}
+	s.confirm(confirmed)
+
+	for number := range s.recent {
+		if number < lib {
+			delete(s.recent, number)
+		}
+	}
+}
+
+// scanRange fetches the blocks from next to head, it returns false if
+// a block could not be read and true when done or after a fork.
+func (s *Scanner) scanRange(head uint64, lib uint64, confirmed uint64) bool {
+	blocks, cancel := s.fetcher.Fetch(s.next, head)
+	defer cancel()
+
+	for fetched := range blocks {
+		if fetched.Err != nil {
+			log.Println("Listener:", fetched.Err)
+			return false
+		}
+		block := fetched.Block
+
+		if prev, ok := s.recent[block.Number-1]; ok && prev.ID != block.Previous {
+			log.Println("fork detected at block", block.Number, "previous:", block.Previous, "expected:", prev.ID)
+			if err := s.rollback(block.Number - 1); err != nil {
+				log.Println("Listener: rollback err:", err)
+				return false
+			}
+			return true
+		}
+
+		s.accept(block)
+		s.confirm(confirmed)
+		if block.Number < lib {
+			delete(s.recent, block.Number)
+		}
+		s.next++
+	}
+	return true
+}
+
+func (s *Scanner) accept(block *ScannedBlock) {
+	block.Sent = make(map[string]int)
+	for _, txn := range block.Txns {
+		// delivered before on the old branch
+		if sent, ok := s.orphanSent[txn.TxHash]; ok {
+			block.Sent[txn.TxHash] = sent
+			delete(s.orphanSent, txn.TxHash)
+		}
+	}
+
+	if s.config.ConfirmPolicy == CONFIRM_INSTANT {
+		for _, txn := range block.Txns {
+			if _, ok := block.Sent[txn.TxHash]; ok {
+				continue
+			}
+			txn.MessageType = NOTIFY_TYPE_PENDING
+			s.notify <- txn
+		}
+		for _, txn := range block.Txns {
+			if _, ok := block.Sent[txn.TxHash]; !ok {
+				block.Sent[txn.TxHash] = NOTIFY_TYPE_PENDING
+			}
+		}
+	}
+
+	s.recent[block.Number] = block
+	s.pending.Push(block)
+
+	if s.orphanTip > 0 && block.Number >= s.orphanTip {
+		s.revertOrphans()
+	}
+}
+
+// confirm broadcasts the pending blocks at or below height, then the
+// time of the last one.
+func (s *Scanner) confirm(height uint64) {
+	confirmed := s.pending.PopConfirmed(height)
+	for _, block := range confirmed {
+		for _, txn := range block.Txns {
+			if block.Sent[txn.TxHash] == NOTIFY_TYPE_TX {
+				continue
+			}
+			s.notify <- txn
+		}
+		for _, txn := range block.Txns {
+			block.Sent[txn.TxHash] = NOTIFY_TYPE_TX
+		}
+
+		for _, txn := range block.Failed {
+			txn.MessageType = NOTIFY_TYPE_FAILED
+			s.notify <- txn
+		}
+
+		s.notify <- NotifyMessage{
+			MessageType: NOTIFY_TYPE_ADMIN,
+			Amount:      new(big.Int).SetUint64(block.Number),
+			BlockTime:   block.Time,
+			Cursor:      &Cursor{Number: block.Number, ID: block.ID, Irreversible: s.lib},
+		}
+	}
+
+	if len(confirmed) > 0 {
+		last := confirmed[len(confirmed)-1]
+		s.notify <- NotifyMessage{MessageType: NOTIFY_TYPE_CLOCK, BlockNum: last.Number, BlockTime: last.Time}
+	}
+}
+
+// rollback finds the last block before number which is still on the
+// chain and drops every block read after it.
+func (s *Scanner) rollback(number uint64) error {
+	fork := number
+	for {
+		old, ok := s.recent[fork]
+		if !ok {
+			break
+		}
+		block, err := ReadBlock(s.source, new(big.Int).SetUint64(fork))
+		if err != nil {
+			return err
+		}
+		if block.ID == old.ID {
+			break
+		}
+		fork--
+	}
+	log.Println("chain switched branch after block", fork, ", rescan from", fork+1)
+
+	s.drop(fork, number)
+	s.next = fork + 1
+	return nil
+}
+
+// Feed takes a block pushed by a streaming source. A block at or below
+// the last one fed means the chain switched branch before it.
+func (s *Scanner) Feed(block *ScannedBlock, head uint64, lib uint64) {
+	s.lib = lib
+	if block.Number < s.next {
+		log.Println("chain switched branch, block", block.Number, "received again")
+		s.drop(block.Number-1, s.next-1)
+	}
+
+	s.accept(block)
+	s.confirm(ConfirmedHeight(s.config, head, lib))
+	s.next = block.Number + 1
+
+	for number := range s.recent {
+		if number < lib {
+			delete(s.recent, number)
+		}
+	}
+}
+
+// drop removes the blocks from fork+1 to number, the transfers already
+// delivered from them become orphans.
+func (s *Scanner) drop(fork uint64, number uint64) {
+	for n := fork + 1; n <= number; n++ {
+		old, ok := s.recent[n]
+		if !ok {
+			continue
+		}
+		delete(s.recent, n)
+
+		for _, txn := range old.Txns {
+			sent, ok := old.Sent[txn.TxHash]
+			if !ok {
+				continue
+			}
+			s.orphans = append(s.orphans, txn)
+			s.orphanSent[txn.TxHash] = sent
+		}
+	}
+
+	s.pending.Truncate(fork)
+	if number > s.orphanTip {
+		s.orphanTip = number
+	}
+}
+
+// revertOrphans reports the delivered transfers which vanished from
+// the chain after a fork.
+func (s *Scanner) revertOrphans() {
+	for _, txn := range s.orphans {
+		if _, ok := s.orphanSent[txn.TxHash]; !ok {
+			continue
+		}
+		log.Println("transfer vanished after fork, tx:", txn.TxHash)
+		txn.MessageType = NOTIFY_TYPE_REVERT
+		s.notify <- txn
+	}
+
+	s.orphans = nil
+	s.orphanSent = make(map[string]int)
+	s.orphanTip = 0
+}
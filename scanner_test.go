@@ -0,0 +1,441 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/eoscanada/eos-go"
+	"github.com/eoscanada/eos-go/token"
+)
+
+type testChain struct {
+	source *MemorySource
+	ids    map[uint32]eos.Checksum256
+}
+
+func newTestChain() *testChain {
+	return &testChain{source: NewMemorySource(), ids: make(map[uint32]eos.Checksum256)}
+}
+
+// add puts a block on top of the block num-1 last added, branch makes
+// the block id differ between forks.
+func (c *testChain) add(num uint32, branch byte, txs ...*eos.PackedTransaction) {
+	id := make(eos.Checksum256, 32)
+	binary.BigEndian.PutUint32(id, num)
+	id[4] = branch
+
+	block := &eos.BlockResp{ID: id, BlockNum: num}
+	block.Previous = c.ids[num-1]
+	block.Timestamp = eos.BlockTimestamp{Time: time.Unix(1600000000+int64(num), 0)}
+	for _, packed := range txs {
+		txid, _ := packed.ID()
+		block.Transactions = append(block.Transactions, eos.TransactionReceipt{
+			TransactionReceiptHeader: eos.TransactionReceiptHeader{Status: eos.TransactionStatusExecuted},
+			Transaction:              eos.TransactionWithID{ID: txid, Packed: packed},
+		})
+	}
+
+	c.ids[num] = id
+	c.source.PutBlock(block)
+}
+
+func testTransfer(t *testing.T, from string, to string, amount int64, memo string) *eos.PackedTransaction {
+	return testTransaction(t, token.NewTransfer(eos.AccountName(from), eos.AccountName(to), eos.NewEOSAsset(amount), memo))
+}
+
+func testTransaction(t *testing.T, actions ...*eos.Action) *eos.PackedTransaction {
+	tx := eos.NewTransaction(actions, &eos.TxOptions{HeadBlockID: make(eos.Checksum256, 32)})
+	packed, err := eos.NewSignedTransaction(tx).Pack(eos.CompressionNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packed
+}
+
+func drain(ch chan NotifyMessage) []NotifyMessage {
+	messages, _ := drainCursor(ch)
+	return messages
+}
+
+// drainCursor also returns the last cursor carried by an admin message.
+func drainCursor(ch chan NotifyMessage) ([]NotifyMessage, *Cursor) {
+	var messages []NotifyMessage
+	var cursor *Cursor
+	for {
+		select {
+		case msg := <-ch:
+			if msg.MessageType != NOTIFY_TYPE_ADMIN && msg.MessageType != NOTIFY_TYPE_CLOCK {
+				messages = append(messages, msg)
+			} else if msg.Cursor != nil {
+				cursor = msg.Cursor
+			}
+		default:
+			return messages, cursor
+		}
+	}
+}
+
+func TestScannerWaitsForIrreversible(t *testing.T) {
+	config := &Config{Account: "wallet", ConfirmPolicy: CONFIRM_LIB}
+	chain := newTestChain()
+	for i := uint32(1); i <= 5; i++ {
+		if i == 3 {
+			chain.add(i, 0, testTransfer(t, "alice", "wallet", 10000, "memo1"))
+		} else {
+			chain.add(i, 0)
+		}
+	}
+
+	ch := make(chan NotifyMessage, 100)
+	scanner := NewScanner(config, chain.source, ch, 1)
+	scanner.Scan(5, 2)
+	msgs, cursor := drainCursor(ch)
+	if len(msgs) != 0 {
+		t.Fatalf("got %d messages before block 3 is irreversible", len(msgs))
+	}
+	if cursor == nil || cursor.Number != 2 || cursor.ID != chain.ids[2].String() {
+		t.Errorf("unexpected cursor %+v", cursor)
+	}
+
+	scanner.Scan(5, 3)
+	msgs = drain(ch)
+	if len(msgs) != 1 || msgs[0].MessageType != NOTIFY_TYPE_TX || msgs[0].Memo != "memo1" {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+}
+
+func TestScannerInstantConfirmsLater(t *testing.T) {
+	config := &Config{Account: "wallet", ConfirmPolicy: CONFIRM_INSTANT}
+	chain := newTestChain()
+	chain.add(1, 0)
+	chain.add(2, 0, testTransfer(t, "alice", "wallet", 10000, "memo1"))
+
+	ch := make(chan NotifyMessage, 100)
+	scanner := NewScanner(config, chain.source, ch, 1)
+	scanner.Scan(2, 1)
+	msgs := drain(ch)
+	if len(msgs) != 1 || msgs[0].MessageType != NOTIFY_TYPE_PENDING {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+
+	scanner.Scan(2, 2)
+	msgs = drain(ch)
+	if len(msgs) != 1 || msgs[0].MessageType != NOTIFY_TYPE_TX {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+}
+
+func TestScannerRevertsForkedTransfers(t *testing.T) {
+	config := &Config{Account: "wallet", ConfirmPolicy: CONFIRM_BLOCKS, ConfirmBlocks: 1}
+	kept := testTransfer(t, "alice", "wallet", 10000, "kept")
+	lost := testTransfer(t, "bob", "wallet", 20000, "lost")
+
+	chain := newTestChain()
+	chain.add(1, 0)
+	chain.add(2, 0)
+	chain.add(3, 0, kept, lost)
+	chain.add(4, 0)
+
+	ch := make(chan NotifyMessage, 100)
+	scanner := NewScanner(config, chain.source, ch, 1)
+	scanner.Scan(4, 1)
+	if msgs := drain(ch); len(msgs) != 2 {
+		t.Fatalf("got %d messages, want 2", len(msgs))
+	}
+
+	// the chain switches to a branch after block 2 which drops one transfer
+	chain.add(3, 1, kept)
+	chain.add(4, 1)
+	chain.add(5, 1)
+	scanner.Scan(5, 1)
+
+	msgs := drain(ch)
+	if len(msgs) != 1 || msgs[0].MessageType != NOTIFY_TYPE_REVERT || msgs[0].Memo != "lost" {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+	if scanner.Next() != 6 {
+		t.Errorf("next block is %d, want 6", scanner.Next())
+	}
+}
+
+func TestScannerFailedAndDeferred(t *testing.T) {
+	config := &Config{Account: "wallet", ConfirmPolicy: CONFIRM_LIB}
+	failed := testTransfer(t, "alice", "wallet", 10000, "failed")
+	failedID, _ := failed.ID()
+
+	// a deferred transaction only has its id in the block
+	deferredID := make(eos.Checksum256, 32)
+	deferredID[0] = 0xde
+	deferred := &eos.TransactionResp{ID: deferredID}
+	deferred.Transaction.Transaction.Transaction = &eos.Transaction{Actions: []*eos.Action{
+		token.NewTransfer("bob", "wallet", eos.NewEOSAsset(20000), "deferred"),
+	}}
+
+	chain := newTestChain()
+	chain.add(1, 0)
+	chain.add(2, 0)
+	chain.add(3, 0)
+	block, _ := chain.source.BlockByNum(2)
+	block.Transactions = []eos.TransactionReceipt{
+		{
+			TransactionReceiptHeader: eos.TransactionReceiptHeader{Status: eos.TransactionStatusHardFail},
+			Transaction:              eos.TransactionWithID{ID: failedID, Packed: failed},
+		},
+		{
+			TransactionReceiptHeader: eos.TransactionReceiptHeader{Status: eos.TransactionStatusExecuted},
+			Transaction:              eos.TransactionWithID{ID: deferredID},
+		},
+	}
+
+	ch := make(chan NotifyMessage, 100)
+	scanner := NewScanner(config, chain.source, ch, 1)
+	// the block waits for the lookup of the deferred transaction
+	scanner.Scan(3, 3)
+	if msgs, cursor := drainCursor(ch); len(msgs) != 0 || cursor == nil || cursor.Number != 1 {
+		t.Fatalf("block scanned without its deferred tx: %+v, cursor %+v", msgs, cursor)
+	}
+
+	chain.source.PutTransaction(deferred)
+	scanner.Scan(3, 3)
+	msgs := drain(ch)
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want 2: %+v", len(msgs), msgs)
+	}
+	for _, msg := range msgs {
+		switch msg.Memo {
+		case "failed":
+			if msg.MessageType != NOTIFY_TYPE_FAILED || msg.Status != "hard_fail" || msg.BlockNum != 2 {
+				t.Errorf("unexpected failed message %+v", msg)
+			}
+		case "deferred":
+			if msg.MessageType != NOTIFY_TYPE_TX || msg.TxHash != deferredID.String() || msg.Ordinal != 1 {
+				t.Errorf("unexpected deferred message %+v", msg)
+			}
+		default:
+			t.Errorf("unexpected message %+v", msg)
+		}
+	}
+}
+
+// TestForkRevertsDelivery checks that a deposit dropped by a fork leaves
+// the ledger and is taken back from the sinks which got it.
+func TestForkRevertsDelivery(t *testing.T) {
+	store, cleanup := openTestStore(t)
+	defer cleanup()
+
+	config := &Config{
+		Account:       "wallet",
+		Accounts:      []*WatchedAccount{{Name: "wallet", MemoScheme: MEMO_SCHEME_UID}},
+		Tokens:        []*Token{EOSToken()},
+		Sinks:         []string{"test"},
+		ConfirmPolicy: CONFIRM_BLOCKS,
+		ConfirmBlocks: 1,
+	}
+	kept := testTransfer(t, "alice", "wallet", 10000, "42")
+	sent := testTransfer(t, "bob", "wallet", 20000, "43")
+	queued := testTransfer(t, "bob", "wallet", 30000, "44")
+	keptID, _ := kept.ID()
+	sentID, _ := sent.ID()
+
+	chain := newTestChain()
+	chain.add(1, 0)
+	chain.add(2, 0)
+	chain.add(3, 0, kept, sent)
+	chain.add(4, 0)
+
+	ch := make(chan NotifyMessage, 100)
+	scanner := NewScanner(config, chain.source, ch, 1)
+	handle := func() []NotifyMessage {
+		msgs := drain(ch)
+		for i := range msgs {
+			HandleTransfer(config, store, nil, &msgs[i])
+		}
+		return msgs
+	}
+	scanner.Scan(4, 1)
+	handle()
+	sink := &testSink{up: true}
+	outbox := NewOutbox(config, store, map[string]DepositSink{"test": sink})
+	outbox.Flush(time.Now())
+
+	// not sent before the fork
+	chain.add(5, 0, queued)
+	chain.add(6, 0)
+	scanner.Scan(6, 1)
+	handle()
+
+	chain.add(3, 1, kept)
+	for i := uint32(4); i <= 7; i++ {
+		chain.add(i, 1)
+	}
+	scanner.Scan(7, 1)
+	if msgs := handle(); len(msgs) != 2 || msgs[0].MessageType != NOTIFY_TYPE_REVERT || msgs[1].MessageType != NOTIFY_TYPE_REVERT {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+
+	entries, _ := store.OutboxEntries(false)
+	if len(entries) != 1 || entries[0].Kind != OUTBOX_REVERT || entries[0].Reverted != OUTBOX_DEPOSIT || entries[0].Hash != sentID.String() || entries[0].Addr != "43" {
+		t.Fatalf("unexpected outbox %+v", entries)
+	}
+	msg := &NotifyMessage{TxHash: sentID.String(), Ordinal: 1}
+	if store.Delivered("wallet", LEDGER_DEPOSIT, msg) {
+		t.Error("reverted deposit still in the ledger")
+	}
+	msg.TxHash = keptID.String()
+	if !store.Delivered("wallet", LEDGER_DEPOSIT, msg) {
+		t.Error("kept deposit left the ledger")
+	}
+	outbox.Flush(time.Now())
+	if len(sink.calls) != 3 || sink.calls[2] != "revert "+sentID.String() {
+		t.Errorf("unexpected calls %v", sink.calls)
+	}
+}
+
+func TestConfirmedHeight(t *testing.T) {
+	for _, c := range []struct {
+		policy int
+		blocks uint64
+		want   uint64
+	}{
+		{CONFIRM_LIB, 0, 80},
+		{CONFIRM_INSTANT, 0, 80},
+		{CONFIRM_BLOCKS, 12, 88},
+		{CONFIRM_BLOCKS, 120, 0},
+	} {
+		config := &Config{ConfirmPolicy: c.policy, ConfirmBlocks: c.blocks}
+		if got := ConfirmedHeight(config, 100, 80); got != c.want {
+			t.Errorf("policy %d/%d: confirmed height is %d, want %d", c.policy, c.blocks, got, c.want)
+		}
+	}
+}
+
+func TestPendingBlocks(t *testing.T) {
+	pending := new(PendingBlocks)
+	for n := uint64(3); n <= 7; n++ {
+		pending.Push(&ScannedBlock{Number: n})
+	}
+
+	if confirmed := pending.PopConfirmed(2); len(confirmed) != 0 || pending.Len() != 5 {
+		t.Fatalf("popped %d blocks below the first one", len(confirmed))
+	}
+	confirmed := pending.PopConfirmed(4)
+	if len(confirmed) != 2 || confirmed[0].Number != 3 || confirmed[1].Number != 4 || pending.Len() != 3 {
+		t.Fatalf("unexpected confirmed blocks %+v, %d left", confirmed, pending.Len())
+	}
+	// a fork after block 5 drops the blocks above it
+	pending.Truncate(5)
+	if confirmed = pending.PopConfirmed(10); len(confirmed) != 1 || confirmed[0].Number != 5 {
+		t.Fatalf("unexpected blocks after truncate %+v", confirmed)
+	}
+}
+
+func TestScannerConfirmBlocks(t *testing.T) {
+	config := &Config{Account: "wallet", ConfirmPolicy: CONFIRM_BLOCKS, ConfirmBlocks: 2}
+	chain := newTestChain()
+	chain.add(1, 0)
+	chain.add(2, 0, testTransfer(t, "alice", "wallet", 10000, "memo1"))
+	chain.add(3, 0)
+
+	ch := make(chan NotifyMessage, 100)
+	scanner := NewScanner(config, chain.source, ch, 1)
+	// the last irreversible block does not matter
+	scanner.Scan(3, 0)
+	if msgs := drain(ch); len(msgs) != 0 {
+		t.Fatalf("got %d messages with one block on top", len(msgs))
+	}
+
+	chain.add(4, 0)
+	scanner.Scan(4, 0)
+	msgs := drain(ch)
+	if len(msgs) != 1 || msgs[0].MessageType != NOTIFY_TYPE_TX || msgs[0].BlockNum != 2 {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+}
+
+// TestScannerForkSameTransaction checks that the transfers of one
+// transaction follow it through a fork: all delivered once when it is
+// included again, all reverted when it is dropped.
+func TestScannerForkSameTransaction(t *testing.T) {
+	config := &Config{Account: "wallet", ConfirmPolicy: CONFIRM_BLOCKS, ConfirmBlocks: 1}
+	transfer := func(memo string) *eos.Action {
+		return token.NewTransfer("alice", "wallet", eos.NewEOSAsset(10000), memo)
+	}
+	kept := testTransaction(t, transfer("a1"), transfer("a2"))
+	lost := testTransaction(t, transfer("b1"), transfer("b2"))
+	lostID, _ := lost.ID()
+
+	chain := newTestChain()
+	chain.add(1, 0)
+	chain.add(2, 0)
+	chain.add(3, 0, kept, lost)
+	chain.add(4, 0)
+
+	ch := make(chan NotifyMessage, 100)
+	scanner := NewScanner(config, chain.source, ch, 1)
+	scanner.Scan(4, 1)
+	if msgs := drain(ch); len(msgs) != 4 {
+		t.Fatalf("got %d messages, want 4", len(msgs))
+	}
+
+	// the new branch includes one transaction a block later
+	chain.add(3, 1)
+	chain.add(4, 1, kept)
+	chain.add(5, 1)
+	chain.add(6, 1)
+	scanner.Scan(6, 1)
+
+	msgs := drain(ch)
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want 2: %+v", len(msgs), msgs)
+	}
+	ordinals := make(map[uint32]bool)
+	for _, msg := range msgs {
+		if msg.MessageType != NOTIFY_TYPE_REVERT || msg.TxHash != lostID.String() {
+			t.Errorf("unexpected message %+v", msg)
+		}
+		ordinals[msg.Ordinal] = true
+	}
+	if !ordinals[1] || !ordinals[2] {
+		t.Errorf("reverted ordinals %v, want 1 and 2", ordinals)
+	}
+}
+
+// TestScannerFeedFork checks that a streamed block at or below the last
+// one fed drops the blocks after it.
+func TestScannerFeedFork(t *testing.T) {
+	config := &Config{Account: "wallet", ConfirmPolicy: CONFIRM_BLOCKS, ConfirmBlocks: 1}
+	chain := newTestChain()
+	chain.add(1, 0)
+	chain.add(2, 0, testTransfer(t, "alice", "wallet", 10000, "lost"))
+	chain.add(3, 0)
+
+	ch := make(chan NotifyMessage, 100)
+	scanner := NewScanner(config, chain.source, ch, 1)
+	feed := func(num uint32, head uint64) {
+		block, err := ReadBlock(chain.source, big.NewInt(int64(num)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner.Feed(block, head, 1)
+	}
+	for num := uint32(1); num <= 3; num++ {
+		feed(num, uint64(num))
+	}
+	if msgs := drain(ch); len(msgs) != 1 || msgs[0].Memo != "lost" {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+
+	chain.add(2, 1)
+	chain.add(3, 1)
+	feed(2, 2)
+	feed(3, 3)
+	msgs := drain(ch)
+	if len(msgs) != 1 || msgs[0].MessageType != NOTIFY_TYPE_REVERT || msgs[0].Memo != "lost" {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+	if scanner.Next() != 4 {
+		t.Errorf("next block is %d, want 4", scanner.Next())
+	}
+}
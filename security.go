@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	SECURITY_COUNTERFEIT   = "counterfeit"
+	SECURITY_PRECISION     = "precision"
+	SECURITY_SPOOF         = "spoof"
+	SECURITY_UNKNOWN_TOKEN = "unknown_token"
+)
+
+// SecurityEvent is a transfer to a watched account that was rejected.
+type SecurityEvent struct {
+	Time      int64  `json:"time"`
+	Kind      string `json:"kind"`
+	Account   string `json:"account"`
+	TxHash    string `json:"tx_hash"`
+	BlockTime int64  `json:"block_time"`
+	Contract  string `json:"contract"`
+	Symbol    string `json:"symbol"`
+	Precision int    `json:"precision"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Receiver  string `json:"receiver,omitempty"`
+	Amount    string `json:"amount"`
+	Memo      string `json:"memo"`
+}
+
+// CheckTransfer verifies a transfer to the watched accounts. The token
+// must be registered with the same contract, symbol and precision, and
+// a notification must be delivered to one of the parties. It returns
+// the token, or the kind of the rejection.
+func CheckTransfer(config *Config, message *NotifyMessage) (*Token, string) {
+	if message.Receiver != "" && message.Receiver != message.AddressTo && message.Receiver != message.AddressFrom {
+		// notified by require_recipient of another transfer
+		return nil, SECURITY_SPOOF
+	}
+
+	t := config.Token(message.Contract, message.Symbol)
+	if t == nil {
+		if config.TokenBySymbol(message.Symbol) != nil {
+			return nil, SECURITY_COUNTERFEIT
+		}
+		return nil, SECURITY_UNKNOWN_TOKEN
+	}
+	if message.Precision != t.Precision {
+		return nil, SECURITY_PRECISION
+	}
+	return t, ""
+}
+
+// SecurityLog reports the rejected transfers to a log of their own and
+// keeps them in the store for the security endpoint.
+type SecurityLog struct {
+	store  *Store
+	logger *log.Logger
+}
+
+func NewSecurityLog(config *Config, store *Store) (*SecurityLog, error) {
+	out := os.Stderr
+	if config.SecurityLogPath != "" {
+		file, err := os.OpenFile(config.SecurityLogPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		out = file
+	}
+	return &SecurityLog{store: store, logger: log.New(out, "SECURITY ", log.LstdFlags)}, nil
+}
+
+func (l *SecurityLog) Report(account string, kind string, message *NotifyMessage) {
+	event := &SecurityEvent{
+		Time:      time.Now().Unix(),
+		Kind:      kind,
+		Account:   account,
+		TxHash:    message.TxHash,
+		BlockTime: message.BlockTime,
+		Contract:  message.Contract,
+		Symbol:    message.Symbol,
+		Precision: message.Precision,
+		From:      message.AddressFrom,
+		To:        message.AddressTo,
+		Receiver:  message.Receiver,
+		Amount:    message.Amount.String(),
+		Memo:      message.Memo,
+	}
+
+	data, _ := json.Marshal(event)
+	l.logger.Println(string(data))
+	if err := l.store.AddSecurityEvent(event); err != nil {
+		log.Println("save security event err:", err)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestCheckTransfer(t *testing.T) {
+	config := &Config{
+		Accounts: []*WatchedAccount{{Name: "wallet"}},
+		Tokens:   []*Token{EOSToken(), {Contract: "tethertether", Symbol: "USDT", Precision: 4, MinDeposit: big.NewInt(0)}},
+	}
+
+	tests := []struct {
+		message NotifyMessage
+		kind    string
+	}{
+		{NotifyMessage{AddressFrom: "alice", AddressTo: "wallet", Contract: "eosio.token", Symbol: "EOS", Precision: 4, Receiver: "wallet"}, ""},
+		{NotifyMessage{AddressFrom: "alice", AddressTo: "wallet", Contract: "tethertether", Symbol: "USDT", Precision: 4}, ""},
+		{NotifyMessage{AddressFrom: "alice", AddressTo: "wallet", Contract: "fakeeostoken", Symbol: "EOS", Precision: 4}, SECURITY_COUNTERFEIT},
+		{NotifyMessage{AddressFrom: "alice", AddressTo: "wallet", Contract: "eosio.token", Symbol: "EOS", Precision: 8}, SECURITY_PRECISION},
+		{NotifyMessage{AddressFrom: "alice", AddressTo: "attacker", Contract: "eosio.token", Symbol: "EOS", Precision: 4, Receiver: "wallet"}, SECURITY_SPOOF},
+		{NotifyMessage{AddressFrom: "alice", AddressTo: "wallet", Contract: "airdroptoken", Symbol: "AIR", Precision: 4}, SECURITY_UNKNOWN_TOKEN},
+	}
+	for i, test := range tests {
+		token, kind := CheckTransfer(config, &test.message)
+		if kind != test.kind || (kind == "") != (token != nil) {
+			t.Errorf("%d: got %q, want %q", i, kind, test.kind)
+		}
+	}
+}
+
+func TestSecurityEvents(t *testing.T) {
+	store, cleanup := openTestStore(t)
+	defer cleanup()
+
+	for _, hash := range []string{"a", "b", "c"} {
+		if err := store.AddSecurityEvent(&SecurityEvent{Kind: SECURITY_SPOOF, TxHash: hash}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, err := store.SecurityEvents(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].TxHash != "c" || events[1].TxHash != "b" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}
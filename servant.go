@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"github.com/TarsCloud/TarsGo/tars"
+	"github.com/TarsCloud/TarsGo/tars/transport"
+	"github.com/bytefly/eos-wallet/NeexTrx"
+	"log"
+)
+
+// WalletServant implements NeexTrx.EosWallet with the same operations as
+// the HTTP API. A refused request returns false with the reason.
+type WalletServant struct {
+	config *Config
+	client *ChainClient
+	store  *Store
+}
+
+func NewWalletServant(config *Config, client *ChainClient, store *Store) *WalletServant {
+	return &WalletServant{config: config, client: client, store: store}
+}
+
+func (s *WalletServant) Send(symbol string, to string, amount string, memo string, hash *string, reason *string) (bool, error) {
+	tx, err := SendTransfer(s.config, s.client, s.store, symbol, to, amount, memo)
+	if err != nil {
+		*reason = err.Error()
+		return false, nil
+	}
+	*hash = tx
+	return true, nil
+}
+
+func (s *WalletServant) Balance(symbol string, address string, balance *string, reason *string) (bool, error) {
+	_, value, err := GetBalance(s.config, s.client, symbol, address)
+	if err != nil {
+		*reason = err.Error()
+		return false, nil
+	}
+	*balance = value
+	return true, nil
+}
+
+func (s *WalletServant) CheckAddr(address string) (bool, error) {
+	return VerifyAddress(s.client, address), nil
+}
+
+func (s *WalletServant) Memo(account string, uid int64, memo *string, reason *string) (bool, error) {
+	if uid < 0 {
+		*reason = "invalid uid"
+		return false, nil
+	}
+	value, _, err := GetMemo(s.config, account, uint64(uid))
+	if err != nil {
+		*reason = err.Error()
+		return false, nil
+	}
+	*memo = value
+	return true, nil
+}
+
+func (s *WalletServant) TxStatus(hash string, status *string, reason *string) (bool, error) {
+	b, err := GetTxStatus(s.store, hash)
+	if err != nil {
+		*reason = err.Error()
+		return false, nil
+	}
+	*status = b.Status
+	*reason = b.Reason
+	return true, nil
+}
+
+// WalletServer serves the servant. Started by a Tars node with a server
+// config, it is added to the framework which listens on the adapter of
+// the config; otherwise it serves on its own address.
+type WalletServer struct {
+	server *transport.TarsServer
+	done   chan struct{}
+}
+
+// TarsServantObj returns the full name of the servant when the Tars node
+// started the wallet with a server config, false when it runs on its own.
+func TarsServantObj(config *Config) (string, bool) {
+	cfg := tars.GetServerConfig()
+	if cfg == nil {
+		return "", false
+	}
+	return cfg.App + "." + cfg.Server + "." + config.ServantObj, true
+}
+
+func NewWalletServer(config *Config, servant *WalletServant) *WalletServer {
+	if obj, ok := TarsServantObj(config); ok {
+		tars.AddServant(new(NeexTrx.EosWallet), servant, obj)
+		return &WalletServer{}
+	}
+
+	proto := tars.NewTarsProtocol(new(NeexTrx.EosWallet), servant, false)
+	conf := &transport.TarsServerConf{
+		Proto:         "tcp",
+		Address:       config.ServantAddr,
+		HandleTimeout: config.ServantTimeout,
+		TCPNoDelay:    true,
+	}
+	return &WalletServer{server: transport.NewTarsServer(proto, conf)}
+}
+
+// Start serves in the background, on the servant address when there is
+// no Tars server config.
+func (s *WalletServer) Start() error {
+	if s.server == nil {
+		s.done = make(chan struct{})
+		go func() {
+			tars.Run()
+			close(s.done)
+		}()
+		return nil
+	}
+
+	if err := s.server.Listen(); err != nil {
+		return err
+	}
+	go func() {
+		if err := s.server.Serve(); err != nil {
+			log.Println("wallet servant err:", err)
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops the servant, the framework stops its own on the signal
+// of the node and is only waited for.
+func (s *WalletServer) Shutdown(ctx context.Context) error {
+	if s.server == nil {
+		select {
+		case <-s.done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return s.server.Shutdown(ctx)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/TarsCloud/TarsGo/tars"
+	"github.com/bytefly/eos-wallet/NeexTrx"
+)
+
+func freeAddr(t *testing.T) (string, int) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String(), ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestWalletServant(t *testing.T) {
+	store, cleanup := openTestStore(t)
+	defer cleanup()
+
+	addr, port := freeAddr(t)
+	config := &Config{
+		Account:        "wallet",
+		Accounts:       []*WatchedAccount{{Name: "wallet", MemoScheme: MEMO_SCHEME_UID}},
+		Tokens:         []*Token{{Symbol: "EOS", Precision: 4}},
+		ServantAddr:    addr,
+		ServantTimeout: time.Second,
+	}
+	server := NewWalletServer(config, NewWalletServant(config, nil, store))
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Shutdown(context.Background())
+
+	if err := store.TrackBroadcast(&Broadcast{ID: "aa", Account: "wallet", Expiration: time.Now().Unix() + 30}); err != nil {
+		t.Fatal(err)
+	}
+
+	app := new(NeexTrx.EosWallet)
+	tars.NewCommunicator().StringToProxy(fmt.Sprintf("NeexTrx.EosWallet.Obj@tcp -h 127.0.0.1 -p %d -t 60000", port), app)
+	app.TarsSetTimeout(3000)
+
+	var memo, status, hash, reason string
+	if ok, err := app.Memo("", 42, &memo, &reason); err != nil || !ok || memo != "42" {
+		t.Fatalf("memo: %v %v %q %q", ok, err, memo, reason)
+	}
+	if ok, err := app.Memo("bob", 42, &memo, &reason); err != nil || ok || reason != "unknown account" {
+		t.Fatalf("memo of an unknown account: %v %v %q", ok, err, reason)
+	}
+	if ok, err := app.TxStatus("aa", &status, &reason); err != nil || !ok || status != BROADCAST_PENDING {
+		t.Fatalf("tx status: %v %v %q", ok, err, status)
+	}
+	if ok, err := app.TxStatus("bb", &status, &reason); err != nil || !ok || status != BROADCAST_UNKNOWN {
+		t.Fatalf("status of an unknown tx: %v %v %q", ok, err, status)
+	}
+	if ok, err := app.CheckAddr("Bob!"); err != nil || ok {
+		t.Fatalf("check address: %v %v", ok, err)
+	}
+	// refused by the checks shared with the HTTP handlers
+	if ok, err := app.Send("XYZ", "bob", "1.0000", "", &hash, &reason); err != nil || ok || reason != "Unknown token" {
+		t.Fatalf("send: %v %v %q", ok, err, reason)
+	}
+}
@@ -0,0 +1,620 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/eoscanada/eos-go"
+	"github.com/eoscanada/eos-go/token"
+	"github.com/gorilla/websocket"
+)
+
+// variants of the state history protocol
+const (
+	SHIP_GET_STATUS_REQUEST = iota
+	SHIP_GET_BLOCKS_REQUEST
+	SHIP_GET_BLOCKS_ACK_REQUEST
+)
+
+const (
+	SHIP_GET_STATUS_RESULT = iota
+	SHIP_GET_BLOCKS_RESULT
+)
+
+const shipMessagesInFlight = 10
+
+type ShipBlockPosition struct {
+	BlockNum uint32
+	BlockID  eos.Checksum256
+}
+
+type ShipGetBlocksRequest struct {
+	Variant             eos.Varuint32
+	StartBlockNum       uint32
+	EndBlockNum         uint32
+	MaxMessagesInFlight uint32
+	HavePositions       []ShipBlockPosition
+	IrreversibleOnly    bool
+	FetchBlock          bool
+	FetchTraces         bool
+	FetchDeltas         bool
+}
+
+type ShipGetBlocksAckRequest struct {
+	Variant     eos.Varuint32
+	NumMessages uint32
+}
+
+// ShipBlocksResult is a get_blocks_result_v0, the optional fields are
+// nil when absent.
+type ShipBlocksResult struct {
+	Head             ShipBlockPosition
+	LastIrreversible ShipBlockPosition
+	ThisBlock        *ShipBlockPosition
+	PrevBlock        *ShipBlockPosition
+	Block            []byte
+	Traces           []byte
+	Deltas           []byte
+}
+
+type ShipActionTrace struct {
+	ActionOrdinal        uint32
+	CreatorActionOrdinal uint32
+	Receiver             string
+	Account              string
+	Name                 string
+	Data                 []byte
+}
+
+type ShipTransactionTrace struct {
+	ID            string
+	Status        uint8
+	CPUUsageUs    uint32
+	NetUsageWords uint32
+	ActionTraces  []ShipActionTrace
+}
+
+// shipDecoder reads the parts of the state history types the wallet
+// cares about and skips the rest.
+type shipDecoder struct {
+	*eos.Decoder
+}
+
+func (d shipDecoder) readOptional() (bool, error) {
+	flag, err := d.ReadUint8()
+	return flag != 0, err
+}
+
+func (d shipDecoder) readPosition() (pos ShipBlockPosition, err error) {
+	if pos.BlockNum, err = d.ReadUint32(); err != nil {
+		return
+	}
+	pos.BlockID, err = d.ReadChecksum256()
+	return
+}
+
+func (d shipDecoder) readOptionalPosition() (*ShipBlockPosition, error) {
+	ok, err := d.readOptional()
+	if err != nil || !ok {
+		return nil, err
+	}
+	pos, err := d.readPosition()
+	return &pos, err
+}
+
+func (d shipDecoder) readOptionalBytes() ([]byte, error) {
+	ok, err := d.readOptional()
+	if err != nil || !ok {
+		return nil, err
+	}
+	return d.ReadByteArray()
+}
+
+func (d shipDecoder) skipOptionalString() error {
+	ok, err := d.readOptional()
+	if err == nil && ok {
+		_, err = d.ReadString()
+	}
+	return err
+}
+
+func (d shipDecoder) skipOptionalUint64() error {
+	ok, err := d.readOptional()
+	if err == nil && ok {
+		_, err = d.ReadUint64()
+	}
+	return err
+}
+
+func (d shipDecoder) skipAccountDelta() error {
+	if _, err := d.ReadName(); err != nil {
+		return err
+	}
+	_, err := d.ReadInt64()
+	return err
+}
+
+func (d shipDecoder) readActionTrace() (trace ShipActionTrace, err error) {
+	variant, err := d.ReadUvarint32()
+	if err != nil {
+		return
+	}
+	if variant > 1 {
+		return trace, fmt.Errorf("unknown action_trace variant %d", variant)
+	}
+
+	if trace.ActionOrdinal, err = d.ReadUvarint32(); err != nil {
+		return
+	}
+	if trace.CreatorActionOrdinal, err = d.ReadUvarint32(); err != nil {
+		return
+	}
+
+	hasReceipt, err := d.readOptional()
+	if err != nil {
+		return
+	}
+	if hasReceipt {
+		if _, err = d.ReadUvarint32(); err != nil { // action_receipt_v0
+			return
+		}
+		if _, err = d.ReadName(); err != nil {
+			return
+		}
+		if _, err = d.ReadChecksum256(); err != nil {
+			return
+		}
+		if _, err = d.ReadUint64(); err != nil { // global_sequence
+			return
+		}
+		if _, err = d.ReadUint64(); err != nil { // recv_sequence
+			return
+		}
+		var count uint32
+		if count, err = d.ReadUvarint32(); err != nil {
+			return
+		}
+		for i := uint32(0); i < count; i++ {
+			if _, err = d.ReadName(); err != nil {
+				return
+			}
+			if _, err = d.ReadUint64(); err != nil {
+				return
+			}
+		}
+		if _, err = d.ReadUvarint32(); err != nil { // code_sequence
+			return
+		}
+		if _, err = d.ReadUvarint32(); err != nil { // abi_sequence
+			return
+		}
+	}
+
+	receiver, err := d.ReadName()
+	if err != nil {
+		return
+	}
+	trace.Receiver = string(receiver)
+
+	account, err := d.ReadName()
+	if err != nil {
+		return
+	}
+	trace.Account = string(account)
+	name, err := d.ReadName()
+	if err != nil {
+		return
+	}
+	trace.Name = string(name)
+	count, err := d.ReadUvarint32()
+	if err != nil {
+		return
+	}
+	for i := uint32(0); i < count; i++ {
+		if _, err = d.ReadName(); err != nil {
+			return
+		}
+		if _, err = d.ReadName(); err != nil {
+			return
+		}
+	}
+	if trace.Data, err = d.ReadByteArray(); err != nil {
+		return
+	}
+
+	if _, err = d.ReadBool(); err != nil { // context_free
+		return
+	}
+	if _, err = d.ReadInt64(); err != nil { // elapsed
+		return
+	}
+	if _, err = d.ReadString(); err != nil { // console
+		return
+	}
+	if count, err = d.ReadUvarint32(); err != nil {
+		return
+	}
+	for i := uint32(0); i < count; i++ {
+		if err = d.skipAccountDelta(); err != nil {
+			return
+		}
+	}
+	if err = d.skipOptionalString(); err != nil {
+		return
+	}
+	if err = d.skipOptionalUint64(); err != nil {
+		return
+	}
+	if variant == 1 {
+		_, err = d.ReadByteArray() // return_value
+	}
+	return
+}
+
+func (d shipDecoder) skipPartialTransaction() error {
+	if _, err := d.ReadUvarint32(); err != nil { // partial_transaction_v0
+		return err
+	}
+	if _, err := d.ReadUint32(); err != nil { // expiration
+		return err
+	}
+	if _, err := d.ReadUint16(); err != nil { // ref_block_num
+		return err
+	}
+	if _, err := d.ReadUint32(); err != nil { // ref_block_prefix
+		return err
+	}
+	if _, err := d.ReadUvarint32(); err != nil { // max_net_usage_words
+		return err
+	}
+	if _, err := d.ReadUint8(); err != nil { // max_cpu_usage_ms
+		return err
+	}
+	if _, err := d.ReadUvarint32(); err != nil { // delay_sec
+		return err
+	}
+	count, err := d.ReadUvarint32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		if _, err = d.ReadUint16(); err != nil {
+			return err
+		}
+		if _, err = d.ReadByteArray(); err != nil {
+			return err
+		}
+	}
+	if count, err = d.ReadUvarint32(); err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		if _, err = d.ReadSignature(); err != nil {
+			return err
+		}
+	}
+	if count, err = d.ReadUvarint32(); err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		if _, err = d.ReadByteArray(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d shipDecoder) readTransactionTrace() (trace ShipTransactionTrace, err error) {
+	variant, err := d.ReadUvarint32()
+	if err != nil {
+		return
+	}
+	if variant != 0 {
+		return trace, fmt.Errorf("unknown transaction_trace variant %d", variant)
+	}
+
+	id, err := d.ReadChecksum256()
+	if err != nil {
+		return
+	}
+	trace.ID = id.String()
+	if trace.Status, err = d.ReadUint8(); err != nil {
+		return
+	}
+	if trace.CPUUsageUs, err = d.ReadUint32(); err != nil {
+		return
+	}
+	if trace.NetUsageWords, err = d.ReadUvarint32(); err != nil {
+		return
+	}
+	if _, err = d.ReadInt64(); err != nil { // elapsed
+		return
+	}
+	if _, err = d.ReadUint64(); err != nil { // net_usage
+		return
+	}
+	if _, err = d.ReadBool(); err != nil { // scheduled
+		return
+	}
+
+	count, err := d.ReadUvarint32()
+	if err != nil {
+		return
+	}
+	for i := uint32(0); i < count; i++ {
+		var action ShipActionTrace
+		if action, err = d.readActionTrace(); err != nil {
+			return
+		}
+		trace.ActionTraces = append(trace.ActionTraces, action)
+	}
+
+	ok, err := d.readOptional() // account_ram_delta
+	if err != nil {
+		return
+	}
+	if ok {
+		if err = d.skipAccountDelta(); err != nil {
+			return
+		}
+	}
+	if err = d.skipOptionalString(); err != nil {
+		return
+	}
+	if err = d.skipOptionalUint64(); err != nil {
+		return
+	}
+	if ok, err = d.readOptional(); err != nil { // failed_dtrx_trace
+		return
+	}
+	if ok {
+		if _, err = d.readTransactionTrace(); err != nil {
+			return
+		}
+	}
+	if ok, err = d.readOptional(); err != nil {
+		return
+	}
+	if ok {
+		err = d.skipPartialTransaction()
+	}
+	return
+}
+
+func DecodeShipResult(data []byte) (*ShipBlocksResult, error) {
+	d := shipDecoder{eos.NewDecoder(data)}
+
+	variant, err := d.ReadUvarint32()
+	if err != nil {
+		return nil, err
+	}
+	if variant != SHIP_GET_BLOCKS_RESULT {
+		return nil, fmt.Errorf("unexpected result variant %d", variant)
+	}
+
+	result := new(ShipBlocksResult)
+	if result.Head, err = d.readPosition(); err != nil {
+		return nil, err
+	}
+	if result.LastIrreversible, err = d.readPosition(); err != nil {
+		return nil, err
+	}
+	if result.ThisBlock, err = d.readOptionalPosition(); err != nil {
+		return nil, err
+	}
+	if result.PrevBlock, err = d.readOptionalPosition(); err != nil {
+		return nil, err
+	}
+	if result.Block, err = d.readOptionalBytes(); err != nil {
+		return nil, err
+	}
+	if result.Traces, err = d.readOptionalBytes(); err != nil {
+		return nil, err
+	}
+	if result.Deltas, err = d.readOptionalBytes(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func DecodeShipTraces(data []byte) ([]ShipTransactionTrace, error) {
+	d := shipDecoder{eos.NewDecoder(data)}
+
+	count, err := d.ReadUvarint32()
+	if err != nil {
+		return nil, err
+	}
+
+	var traces []ShipTransactionTrace
+	for i := uint32(0); i < count; i++ {
+		trace, err := d.readTransactionTrace()
+		if err != nil {
+			return nil, err
+		}
+		traces = append(traces, trace)
+	}
+	return traces, nil
+}
+
+// ShipReader streams blocks and traces from the state history plugin
+// into a scanner.
+type ShipReader struct {
+	config  *Config
+	scanner *Scanner
+}
+
+func NewShipReader(config *Config, scanner *Scanner) *ShipReader {
+	return &ShipReader{config: config, scanner: scanner}
+}
+
+// Stream requests the blocks from the next one of the scanner and
+// feeds them until the connection fails.
+func (r *ShipReader) Stream(url string) error {
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// the first message is the abi of the protocol
+	if _, _, err = conn.ReadMessage(); err != nil {
+		return err
+	}
+
+	// the blocks we hold let the node restart from a fork point
+	var positions []ShipBlockPosition
+	for number, id := range r.scanner.Recent() {
+		blockID, err := hex.DecodeString(id)
+		if err != nil {
+			return err
+		}
+		positions = append(positions, ShipBlockPosition{BlockNum: uint32(number), BlockID: blockID})
+	}
+
+	req, err := eos.MarshalBinary(ShipGetBlocksRequest{
+		Variant:             SHIP_GET_BLOCKS_REQUEST,
+		StartBlockNum:       uint32(r.scanner.Next()),
+		EndBlockNum:         0xffffffff,
+		MaxMessagesInFlight: shipMessagesInFlight,
+		HavePositions:       positions,
+		IrreversibleOnly:    r.config.ConfirmPolicy == CONFIRM_LIB,
+		FetchBlock:          true,
+		FetchTraces:         true,
+		FetchDeltas:         true,
+	})
+	if err != nil {
+		return err
+	}
+	if err = conn.WriteMessage(websocket.BinaryMessage, req); err != nil {
+		return err
+	}
+
+	ack, _ := eos.MarshalBinary(ShipGetBlocksAckRequest{Variant: SHIP_GET_BLOCKS_ACK_REQUEST, NumMessages: 1})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		result, err := DecodeShipResult(data)
+		if err != nil {
+			return err
+		}
+		if result.ThisBlock != nil {
+			block, err := r.parseBlock(result)
+			if err != nil {
+				return fmt.Errorf("block %d: %v", result.ThisBlock.BlockNum, err)
+			}
+			r.scanner.Feed(block, uint64(result.Head.BlockNum), uint64(result.LastIrreversible.BlockNum))
+		}
+
+		if err = conn.WriteMessage(websocket.BinaryMessage, ack); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *ShipReader) parseBlock(result *ShipBlocksResult) (*ScannedBlock, error) {
+	block := &ScannedBlock{
+		Number: uint64(result.ThisBlock.BlockNum),
+		ID:     result.ThisBlock.BlockID.String(),
+	}
+	if result.PrevBlock != nil {
+		block.Previous = result.PrevBlock.BlockID.String()
+	}
+
+	// a signed block starts with its timestamp, in half seconds since 2000
+	var ts int64
+	if len(result.Block) >= 4 {
+		slot, _ := eos.NewDecoder(result.Block).ReadUint32()
+		ts = (946684800000 + int64(slot)*500) / 1000
+	}
+	block.Time = ts
+
+	if len(result.Traces) == 0 {
+		return block, nil
+	}
+	traces, err := DecodeShipTraces(result.Traces)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, trace := range traces {
+		status := eos.TransactionStatus(trace.Status)
+		if status == eos.TransactionStatusDelayed {
+			continue
+		}
+		var msgs []NotifyMessage
+		for i, action := range trace.ActionTraces {
+			// every notification of a transfer is traced, take the
+			// ones delivered to the watched accounts whatever the
+			// contract, the notifier checks them
+			if r.config.Watched(action.Receiver) == nil || action.Name != "transfer" {
+				continue
+			}
+
+			transfer := new(token.Transfer)
+			if err = eos.UnmarshalBinary(action.Data, transfer); err != nil {
+				log.Println("decode transfer of", trace.ID, "err:", err)
+				continue
+			}
+			if msg, ok := ParseTransfer(transfer, action.Account, trace.ID, ts); ok {
+				msg.Receiver = action.Receiver
+				msg.BlockNum = block.Number
+				msg.Ordinal = originalOrdinal(trace.ActionTraces, i)
+				msg.CPUUsage = trace.CPUUsageUs
+				msg.NetUsage = trace.NetUsageWords
+				msgs = append(msgs, msg)
+			}
+		}
+
+		// the executions by the contracts, not their notifications
+		transfers := 0
+		for _, action := range trace.ActionTraces {
+			if action.Receiver == action.Account && action.Name == "transfer" {
+				transfers++
+			}
+		}
+		shareResources(msgs, transfers)
+		for _, msg := range msgs {
+			if status == eos.TransactionStatusExecuted {
+				block.Txns = append(block.Txns, msg)
+			} else {
+				msg.Status = status.String()
+				block.Failed = append(block.Failed, msg)
+			}
+		}
+	}
+	return block, nil
+}
+
+// originalOrdinal returns the ordinal of the action execution a trace
+// belongs to. A notification has an ordinal of its own, it is matched to
+// the execution by the contract with the same creator and data.
+func originalOrdinal(traces []ShipActionTrace, i int) uint32 {
+	action := traces[i]
+	if action.Receiver == action.Account {
+		return action.ActionOrdinal
+	}
+	for _, other := range traces {
+		if other.Receiver == other.Account && other.Account == action.Account && other.Name == action.Name &&
+			other.CreatorActionOrdinal == action.CreatorActionOrdinal && bytes.Equal(other.Data, action.Data) {
+			return other.ActionOrdinal
+		}
+	}
+	return action.ActionOrdinal
+}
+
+func ShipListener(config *Config, notifyChannel chan<- NotifyMessage, last_id uint64) {
+	scanner := NewScanner(config, nil, notifyChannel, last_id)
+	reader := NewShipReader(config, scanner)
+
+	for {
+		err := reader.Stream(config.ShipURL)
+		log.Println("ShipListener:", err)
+		time.Sleep(5 * time.Second)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eoscanada/eos-go"
+	"github.com/eoscanada/eos-go/token"
+	"github.com/gorilla/websocket"
+)
+
+type shipWriter struct {
+	bytes.Buffer
+}
+
+func (w *shipWriter) put(values ...interface{}) *shipWriter {
+	enc := eos.NewEncoder(&w.Buffer)
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			panic(err)
+		}
+	}
+	return w
+}
+
+func shipID(num uint32) eos.Checksum256 {
+	id := make(eos.Checksum256, 32)
+	binary.BigEndian.PutUint32(id, num)
+	return id
+}
+
+func shipTransferTrace(receiver string, from string, to string, amount int64, memo string) []byte {
+	data, _ := eos.MarshalBinary(token.Transfer{
+		From:     eos.AccountName(from),
+		To:       eos.AccountName(to),
+		Quantity: eos.NewEOSAsset(amount),
+		Memo:     memo,
+	})
+
+	w := new(shipWriter)
+	w.put(eos.Varuint32(0), eos.Varuint32(2), eos.Varuint32(1))
+	// receipt
+	w.put(byte(1), eos.Varuint32(0), eos.Name(receiver), make(eos.Checksum256, 32), uint64(1), uint64(1))
+	w.put(eos.Varuint32(1), eos.Name(from), uint64(1), eos.Varuint32(1), eos.Varuint32(1))
+	// receiver and act
+	w.put(eos.Name(receiver), eos.Name("eosio.token"), eos.Name("transfer"))
+	w.put(eos.Varuint32(1), eos.Name(from), eos.Name("active"), eos.HexBytes(data))
+	w.put(false, int64(10), "", eos.Varuint32(0), byte(0), byte(0))
+	return w.Bytes()
+}
+
+func shipTransactionTrace(id byte, status byte, actions ...[]byte) []byte {
+	txid := make(eos.Checksum256, 32)
+	txid[31] = id
+
+	w := new(shipWriter)
+	w.put(eos.Varuint32(0), txid, status, uint32(100), eos.Varuint32(16), int64(100), uint64(128), false)
+	w.put(eos.Varuint32(len(actions)))
+	for _, action := range actions {
+		w.Write(action)
+	}
+	w.put(byte(0), byte(0), byte(0), byte(0), byte(0))
+	return w.Bytes()
+}
+
+func shipResult(num uint32, lib uint32, traces ...[]byte) []byte {
+	tw := new(shipWriter)
+	tw.put(eos.Varuint32(len(traces)))
+	for _, trace := range traces {
+		tw.Write(trace)
+	}
+
+	w := new(shipWriter)
+	w.put(eos.Varuint32(SHIP_GET_BLOCKS_RESULT))
+	w.put(num, shipID(num), lib, shipID(lib))
+	w.put(byte(1), num, shipID(num), byte(1), num-1, shipID(num-1))
+	// the block only holds its timestamp here
+	w.put(byte(1), eos.HexBytes{0x10, 0x00, 0x00, 0x00})
+	w.put(byte(1), eos.HexBytes(tw.Bytes()))
+	w.put(byte(0))
+	return w.Bytes()
+}
+
+func TestShipReader(t *testing.T) {
+	frames := [][]byte{
+		shipResult(5, 4),
+		shipResult(6, 5,
+			shipTransactionTrace(1, 0,
+				// the contract notifies both parties of an inline transfer
+				shipTransferTrace("eosio.token", "dexcontract", "wallet", 10000, "inline"),
+				shipTransferTrace("dexcontract", "dexcontract", "wallet", 10000, "inline"),
+				shipTransferTrace("wallet", "dexcontract", "wallet", 10000, "inline"),
+			),
+			shipTransactionTrace(2, 2, shipTransferTrace("wallet", "alice", "wallet", 20000, "failed")),
+		),
+		shipResult(7, 7),
+	}
+
+	var request []byte
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteMessage(websocket.TextMessage, []byte("{}"))
+		if _, request, err = conn.ReadMessage(); err != nil {
+			return
+		}
+		for _, frame := range frames {
+			conn.WriteMessage(websocket.BinaryMessage, frame)
+			if _, _, err = conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	config := &Config{Account: "wallet", Accounts: []*WatchedAccount{{Name: "wallet"}}, Tokens: []*Token{EOSToken()}, ConfirmPolicy: CONFIRM_LIB}
+	ch := make(chan NotifyMessage, 100)
+	scanner := NewScanner(config, nil, ch, 5)
+	reader := NewShipReader(config, scanner)
+	reader.Stream("ws" + strings.TrimPrefix(server.URL, "http"))
+
+	if len(request) < 5 || request[0] != SHIP_GET_BLOCKS_REQUEST || binary.LittleEndian.Uint32(request[1:]) != 5 {
+		t.Errorf("unexpected request %x", request)
+	}
+
+	msgs, cursor := drainCursor(ch)
+	if len(msgs) != 2 || msgs[0].Memo != "inline" || msgs[0].MessageType != NOTIFY_TYPE_TX || msgs[0].Receiver != "wallet" {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+	if msgs[1].MessageType != NOTIFY_TYPE_FAILED || msgs[1].Status != "hard_fail" {
+		t.Errorf("failed transfer reported as %+v", msgs[1])
+	}
+	if msgs[0].BlockTime != 946684808 {
+		t.Errorf("block time is %d", msgs[0].BlockTime)
+	}
+	if msgs[0].Ordinal != 2 || msgs[0].BlockNum != 6 {
+		t.Errorf("transfer %d of block %d", msgs[0].Ordinal, msgs[0].BlockNum)
+	}
+	if scanner.Next() != 8 || cursor == nil || cursor.Number != 7 {
+		t.Errorf("next block is %d, want 8", scanner.Next())
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	SINK_TARS    = "tars"
+	SINK_WEBHOOK = "webhook"
+	SINK_JSONL   = "jsonl"
+)
+
+// DepositSink receives the deposit, withdraw, fee, failed withdraw and
+// revert events of the watched accounts. ok false asks for the event to
+// be sent again. A revert may come for an event the sink never got, as
+// when its only attempt failed.
+type DepositSink interface {
+	Deposit(account *WatchedAccount, entry *OutboxEntry) (ok bool, err error)
+	Withdraw(account *WatchedAccount, entry *OutboxEntry) (ok bool, err error)
+	Fee(account *WatchedAccount, entry *OutboxEntry) (ok bool, err error)
+	WithdrawFailed(account *WatchedAccount, entry *OutboxEntry) (ok bool, err error)
+	Revert(account *WatchedAccount, entry *OutboxEntry) (ok bool, err error)
+}
+
+// NewDepositSinks builds the sinks enabled in the configuration, by
+// name. The calls in progress are given up when ctx is cancelled.
+func NewDepositSinks(ctx context.Context, config *Config) (map[string]DepositSink, error) {
+	sinks := make(map[string]DepositSink)
+	for _, name := range config.EnabledSinks() {
+		switch name {
+		case SINK_TARS:
+			sinks[name] = NewTarsSink(ctx, config)
+		case SINK_WEBHOOK:
+			sinks[name] = NewWebhookSink(config)
+		case SINK_JSONL:
+			sink, err := NewJSONLSink(config.JSONLPath)
+			if err != nil {
+				return nil, err
+			}
+			sinks[name] = sink
+		default:
+			return nil, fmt.Errorf("unknown sink %s", name)
+		}
+	}
+	return sinks, nil
+}
+
+// SinkEvent is the payload of the webhook and of the JSONL file.
+type SinkEvent struct {
+	Event     string `json:"event"`
+	Account   string `json:"account"`
+	ChainId   int    `json:"chain_id"`
+	Symbol    string `json:"symbol"`
+	Hash      string `json:"hash"`
+	Transfer  string `json:"transfer,omitempty"`
+	Addr      string `json:"addr,omitempty"`
+	Amount    string `json:"amount,omitempty"`
+	Fee       string `json:"fee,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Reverted  string `json:"reverted,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+
+	Deposit *DepositDetail `json:"deposit,omitempty"`
+}
+
+func newSinkEvent(account *WatchedAccount, entry *OutboxEntry) *SinkEvent {
+	return &SinkEvent{
+		Event:     entry.Kind,
+		Account:   account.Name,
+		ChainId:   account.ChainId,
+		Symbol:    entry.Symbol,
+		Hash:      entry.Hash,
+		Transfer:  entry.Transfer,
+		Addr:      entry.Addr,
+		Amount:    entry.Amount,
+		Fee:       entry.Fee,
+		Status:    entry.Status,
+		Reason:    entry.Reason,
+		Reverted:  entry.Reverted,
+		Timestamp: time.Now().Unix(),
+		Deposit:   entry.Deposit,
+	}
+}
+
+// WebhookSink posts the events as JSON, signed with HMAC-SHA256 of the
+// body in the X-Signature header. Any 2xx answer accepts the event.
+type WebhookSink struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+func NewWebhookSink(config *Config) *WebhookSink {
+	return &WebhookSink{url: config.WebhookURL, secret: []byte(config.WebhookSecret), client: NewHTTPClient(config.WebhookTimeout)}
+}
+
+// Sign returns the signature of a webhook body.
+func (s *WebhookSink) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *WebhookSink) post(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	body, err := json.Marshal(newSinkEvent(account, entry))
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Signature", s.Sign(body))
+
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode/100 != 2 {
+		return false, fmt.Errorf("webhook answered %s", rsp.Status)
+	}
+	return true, nil
+}
+
+func (s *WebhookSink) Deposit(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	return s.post(account, entry)
+}
+
+func (s *WebhookSink) Withdraw(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	return s.post(account, entry)
+}
+
+func (s *WebhookSink) Fee(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	return s.post(account, entry)
+}
+
+func (s *WebhookSink) WithdrawFailed(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	return s.post(account, entry)
+}
+
+func (s *WebhookSink) Revert(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	return s.post(account, entry)
+}
+
+// JSONLSink appends the events to a file, one JSON object a line.
+type JSONLSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewJSONLSink(path string) (*JSONLSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLSink{file: file}, nil
+}
+
+func (s *JSONLSink) write(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	data, err := json.Marshal(newSinkEvent(account, entry))
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err = s.file.Write(append(data, '\n')); err != nil {
+		log.Println("write jsonl sink err:", err)
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *JSONLSink) Deposit(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	return s.write(account, entry)
+}
+
+func (s *JSONLSink) Withdraw(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	return s.write(account, entry)
+}
+
+func (s *JSONLSink) Fee(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	return s.write(account, entry)
+}
+
+func (s *JSONLSink) WithdrawFailed(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	return s.write(account, entry)
+}
+
+func (s *JSONLSink) Revert(account *WatchedAccount, entry *OutboxEntry) (bool, error) {
+	return s.write(account, entry)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TarsCloud/TarsGo/tars/protocol/codec"
+	"github.com/bytefly/eos-wallet/NeexTrx"
+)
+
+func TestSinks(t *testing.T) {
+	store, cleanup := openTestStore(t)
+	defer cleanup()
+
+	var events []SinkEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		sink := &WebhookSink{secret: []byte("s3cret")}
+		if r.Header.Get("X-Signature") != sink.Sign(body) {
+			w.WriteHeader(401)
+			return
+		}
+		var event SinkEvent
+		json.Unmarshal(body, &event)
+		events = append(events, event)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := &Config{
+		Accounts:          []*WatchedAccount{{Name: "wallet", ChainId: 3}},
+		Sinks:             []string{SINK_WEBHOOK, SINK_JSONL},
+		WebhookURL:        server.URL,
+		WebhookSecret:     "s3cret",
+		WebhookTimeout:    time.Second,
+		JSONLPath:         filepath.Join(dir, "events.jsonl"),
+		OutboxBackoff:     time.Second,
+		OutboxMaxBackoff:  time.Second,
+		OutboxMaxAttempts: 3,
+	}
+	sinks, err := NewDepositSinks(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := &NotifyMessage{TxHash: "dd", Ordinal: 1, BlockNum: 10}
+	entry := &OutboxEntry{Kind: OUTBOX_DEPOSIT, Account: "wallet", Symbol: "EOS", Hash: message.TxHash, Transfer: message.TransferID(), Addr: "42", Amount: "1.0000"}
+	if err := store.Enqueue(config.Sinks, entry, LEDGER_DEPOSIT, message); err != nil {
+		t.Fatal(err)
+	}
+	NewOutbox(config, store, sinks).Flush(time.Now())
+
+	if len(events) != 1 || events[0].Event != OUTBOX_DEPOSIT || events[0].Hash != "dd" || events[0].Transfer != "dd:1" || events[0].ChainId != 3 {
+		t.Fatalf("unexpected webhook events %+v", events)
+	}
+	data, err := ioutil.ReadFile(config.JSONLPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"addr":"42"`) {
+		t.Errorf("unexpected jsonl %q", data)
+	}
+	if pending, _ := store.OutboxEntries(false); len(pending) != 0 {
+		t.Errorf("events left in the outbox %+v", pending)
+	}
+}
+
+func TestTarsSinkCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sink := NewTarsSink(ctx, &Config{TarsObj: "NeexTrx.FreezingSysServer.FreezingSysObj", TarsRegistryPort: 17890, TarsTimeout: time.Minute})
+
+	block := make(chan struct{})
+	defer close(block)
+	go cancel()
+	ok, err := sink.call(func(ctx context.Context) (bool, error) {
+		<-block
+		return true, nil
+	})
+	if ok || err != context.Canceled {
+		t.Errorf("call not given up on shutdown: %v %v", ok, err)
+	}
+}
+
+func TestDepositInfoCodec(t *testing.T) {
+	info := &NeexTrx.DepositInfo{Hash: "ff:2:10", Symbol: "EOS", Amount: "1.0000", Type: 3, Sender: "alice", Account: "wallet", Uid: 42, Memo: "42", BlockNum: 10, BlockTime: 1600000000, ActionOrdinal: 2, Status: CONFIRMATION_IRREVERSIBLE}
+	buf := codec.NewBuffer()
+	if err := info.WriteBlock(buf, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded NeexTrx.DepositInfo
+	if err := decoded.ReadBlock(codec.NewReader(buf.ToBytes()), 1, true); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != *info {
+		t.Errorf("decoded %+v, want %+v", decoded, *info)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/eoscanada/eos-go"
+)
+
+// BlockSource provides the chain head and the blocks to scan.
+type BlockSource interface {
+	HeadInfo() (*eos.InfoResp, error)
+	BlockByNum(num uint32) (*eos.BlockResp, error)
+}
+
+// TransactionSource is implemented by the sources which can look a
+// transaction up by id, for the deferred ones.
+type TransactionSource interface {
+	TransactionByID(id string) (*eos.TransactionResp, error)
+}
+
+func NewBlockSource(config *Config, client *ChainClient) (BlockSource, error) {
+	switch config.BlockSource {
+	case "", "nodeos":
+		return NewNodeosSource(client), nil
+	case "archive":
+		return NewArchiveSource(config.ArchiveDir)
+	}
+	return nil, fmt.Errorf("unknown block source: %s", config.BlockSource)
+}
+
+// NodeosSource reads blocks from the chain API of a nodeos.
+type NodeosSource struct {
+	client *ChainClient
+}
+
+func NewNodeosSource(client *ChainClient) *NodeosSource {
+	return &NodeosSource{client: client}
+}
+
+func (s *NodeosSource) HeadInfo() (*eos.InfoResp, error) {
+	return s.client.GetInfo()
+}
+
+func (s *NodeosSource) BlockByNum(num uint32) (*eos.BlockResp, error) {
+	return s.client.GetBlockByNum(num)
+}
+
+func (s *NodeosSource) TransactionByID(id string) (*eos.TransactionResp, error) {
+	return s.client.GetTransaction(id)
+}
+
+// ArchiveSource replays blocks saved as get_block responses, one file
+// per block named <number>.json, for backfills. Archived blocks are
+// taken as irreversible.
+type ArchiveSource struct {
+	dir  string
+	head uint32
+}
+
+func NewArchiveSource(dir string) (*ArchiveSource, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	source := &ArchiveSource{dir: dir}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		num, err := strconv.ParseUint(strings.TrimSuffix(name, ".json"), 10, 32)
+		if err != nil {
+			continue
+		}
+		if uint32(num) > source.head {
+			source.head = uint32(num)
+		}
+	}
+	if source.head == 0 {
+		return nil, fmt.Errorf("no block found in archive %s", dir)
+	}
+
+	return source, nil
+}
+
+func (s *ArchiveSource) HeadInfo() (*eos.InfoResp, error) {
+	block, err := s.BlockByNum(s.head)
+	if err != nil {
+		return nil, err
+	}
+
+	return &eos.InfoResp{
+		HeadBlockNum:             s.head,
+		HeadBlockID:              block.ID,
+		HeadBlockTime:            block.Timestamp,
+		LastIrreversibleBlockNum: s.head,
+		LastIrreversibleBlockID:  block.ID,
+	}, nil
+}
+
+func (s *ArchiveSource) BlockByNum(num uint32) (*eos.BlockResp, error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, strconv.FormatUint(uint64(num), 10)+".json"))
+	if err != nil {
+		return nil, err
+	}
+
+	block := new(eos.BlockResp)
+	if err = json.Unmarshal(data, block); err != nil {
+		return nil, fmt.Errorf("decode archived block %d: %v", num, err)
+	}
+	return block, nil
+}
+
+// MemorySource serves blocks kept in memory, it is used to feed the
+// scanner in tests.
+type MemorySource struct {
+	mu     sync.Mutex
+	blocks map[uint32]*eos.BlockResp
+	txs    map[string]*eos.TransactionResp
+	head   uint32
+	lib    uint32
+}
+
+func NewMemorySource() *MemorySource {
+	return &MemorySource{blocks: make(map[uint32]*eos.BlockResp), txs: make(map[string]*eos.TransactionResp)}
+}
+
+// PutBlock adds a block or replaces the one with the same number,
+// the head follows the highest block.
+func (s *MemorySource) PutBlock(block *eos.BlockResp) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blocks[block.BlockNum] = block
+	if block.BlockNum > s.head {
+		s.head = block.BlockNum
+	}
+}
+
+// PutTransaction adds a transaction to look up by id.
+func (s *MemorySource) PutTransaction(tx *eos.TransactionResp) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.txs[tx.ID.String()] = tx
+}
+
+func (s *MemorySource) SetIrreversible(lib uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lib = lib
+}
+
+func (s *MemorySource) HeadInfo() (*eos.InfoResp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info := &eos.InfoResp{
+		HeadBlockNum:             s.head,
+		LastIrreversibleBlockNum: s.lib,
+	}
+	if block, ok := s.blocks[s.head]; ok {
+		info.HeadBlockID = block.ID
+		info.HeadBlockTime = block.Timestamp
+	}
+	if block, ok := s.blocks[s.lib]; ok {
+		info.LastIrreversibleBlockID = block.ID
+	}
+	return info, nil
+}
+
+func (s *MemorySource) BlockByNum(num uint32) (*eos.BlockResp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	block, ok := s.blocks[num]
+	if !ok {
+		return nil, eos.ErrNotFound
+	}
+	return block, nil
+}
+
+func (s *MemorySource) TransactionByID(id string) (*eos.TransactionResp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, ok := s.txs[id]
+	if !ok {
+		return nil, eos.ErrNotFound
+	}
+	return tx, nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TarsCloud/TarsGo/tars"
+	"github.com/TarsCloud/TarsGo/tars/transport"
+	"github.com/bytefly/eos-wallet/NeexTrx"
+)
+
+// freezingStandIn stands in for FreezingSys in process. It records every
+// call and fails or refuses the methods it is told to.
+//
+// tars.AddServant needs the Tars node configuration, the servant is put
+// on a transport server the same way as the wallet servant.
+type freezingStandIn struct {
+	Obj string
+
+	mu      sync.Mutex
+	calls   []string
+	infos   []NeexTrx.DepositInfo
+	errs    map[string]error
+	refused map[string]bool
+	server  *transport.TarsServer
+}
+
+func startFreezingStandIn(t *testing.T) (*freezingStandIn, func()) {
+	addr, port := freeAddr(t)
+	s := &freezingStandIn{
+		Obj:     fmt.Sprintf("NeexTrx.FreezingSysServer.FreezingSysObj@tcp -h 127.0.0.1 -p %d -t 60000", port),
+		errs:    make(map[string]error),
+		refused: make(map[string]bool),
+	}
+	proto := tars.NewTarsProtocol(new(NeexTrx.FreezingSys), s, false)
+	s.server = transport.NewTarsServer(proto, &transport.TarsServerConf{Proto: "tcp", Address: addr, TCPNoDelay: true})
+	if err := s.server.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	go s.server.Serve()
+	return s, func() { s.server.Shutdown(context.Background()) }
+}
+
+// Fail makes a method return err, nil to answer again.
+func (s *freezingStandIn) Fail(method string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		delete(s.errs, method)
+	} else {
+		s.errs[method] = err
+	}
+}
+
+// Refuse makes a method return false.
+func (s *freezingStandIn) Refuse(method string, refused bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refused[method] = refused
+}
+
+// Calls returns the calls so far, the method and its arguments
+// separated by spaces.
+func (s *freezingStandIn) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+func (s *freezingStandIn) record(rsp *string, method string, args ...interface{}) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, strings.TrimSpace(method+" "+fmt.Sprintln(args...)))
+	if err := s.errs[method]; err != nil {
+		return false, err
+	}
+	if s.refused[method] {
+		return false, nil
+	}
+	if rsp != nil {
+		*rsp = method + " ok"
+	}
+	return true, nil
+}
+
+func (s *freezingStandIn) User_into_dc2(Addr string, Symbol string, Hash string, Amount string, Type int32) (bool, error) {
+	return s.record(nil, "user_into_dc2", Addr, Symbol, Hash, Amount, Type)
+}
+
+func (s *freezingStandIn) Commit_withdraw_dc(Hash string, Symbol string, Amount string, MinerCost string, Rsp *string) (bool, error) {
+	return s.record(Rsp, "commit_withdraw_dc", Hash, Symbol, Amount, MinerCost)
+}
+
+func (s *freezingStandIn) Insert_innerexchange_fee(Hash string, MinerCost string, Rsp *string) (bool, error) {
+	return s.record(Rsp, "insert_innerexchange_fee", Hash, MinerCost)
+}
+
+func (s *freezingStandIn) User_into_dc3(Info *NeexTrx.DepositInfo, Rsp *string) (bool, error) {
+	s.mu.Lock()
+	s.infos = append(s.infos, *Info)
+	s.mu.Unlock()
+	return s.record(Rsp, "user_into_dc3", Info.Hash, Info.Symbol, Info.Amount, Info.Uid)
+}
+
+func (s *freezingStandIn) Withdraw_failed_dc(Hash string, Symbol string, Amount string, Status string, Reason string, Rsp *string) (bool, error) {
+	return s.record(Rsp, "withdraw_failed_dc", Hash, Symbol, Amount, Status)
+}
+
+func (s *freezingStandIn) Revert_dc(Hash string, ActionOrdinal int32, Kind string, Symbol string, Amount string, Addr string, Type int32, Rsp *string) (bool, error) {
+	return s.record(Rsp, "revert_dc", Hash, ActionOrdinal, Kind, Symbol, Amount, Addr)
+}
+
+func TestFreezingStandIn(t *testing.T) {
+	store, cleanup := openTestStore(t)
+	defer cleanup()
+	standIn, stop := startFreezingStandIn(t)
+	defer stop()
+
+	config := &Config{
+		Account:           "wallet",
+		Accounts:          []*WatchedAccount{{Name: "wallet", ChainId: 3, MemoScheme: MEMO_SCHEME_UID}},
+		Tokens:            []*Token{EOSToken()},
+		Sinks:             []string{SINK_TARS},
+		TarsObj:           standIn.Obj,
+		TarsTimeout:       3 * time.Second,
+		DepositMethod:     DEPOSIT_METHOD_DC2,
+		OutboxBackoff:     time.Second,
+		OutboxMaxBackoff:  time.Second,
+		OutboxMaxAttempts: 5,
+	}
+	sinks, err := NewDepositSinks(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbox := NewOutbox(config, store, sinks)
+
+	transfer := func(from string, to string, memo string, hash string) *NotifyMessage {
+		return &NotifyMessage{
+			MessageType: NOTIFY_TYPE_TX,
+			AddressFrom: from,
+			AddressTo:   to,
+			Contract:    "eosio.token",
+			Symbol:      "EOS",
+			Precision:   4,
+			Amount:      big.NewInt(12345),
+			Memo:        memo,
+			TxHash:      hash,
+			Ordinal:     1,
+			BlockNum:    10,
+		}
+	}
+
+	// a deposit and a withdraw, the withdraw is down at first
+	standIn.Fail("commit_withdraw_dc", fmt.Errorf("database is down"))
+	HandleTransfer(config, store, nil, transfer("alice", "wallet", "42", "aa"))
+	HandleTransfer(config, store, nil, transfer("wallet", "bob", "", "bb"))
+	now := time.Now()
+	outbox.Flush(now)
+
+	pending, _ := store.OutboxEntries(false)
+	if len(pending) != 1 || pending[0].Kind != OUTBOX_WITHDRAW || !strings.Contains(pending[0].LastError, "database is down") {
+		t.Fatalf("unexpected outbox %+v", pending)
+	}
+
+	// refused once back
+	standIn.Fail("commit_withdraw_dc", nil)
+	standIn.Refuse("commit_withdraw_dc", true)
+	outbox.Flush(now.Add(time.Second))
+	standIn.Refuse("commit_withdraw_dc", false)
+	outbox.Flush(now.Add(2 * time.Second))
+
+	want := []string{
+		"user_into_dc2 42 EOS aa 1.2345 3",
+		"commit_withdraw_dc bb EOS 1.2345 0",
+		"commit_withdraw_dc bb EOS 1.2345 0",
+		"commit_withdraw_dc bb EOS 1.2345 0",
+	}
+	if calls := standIn.Calls(); strings.Join(calls, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected calls %q", calls)
+	}
+	if pending, _ = store.OutboxEntries(false); len(pending) != 0 {
+		t.Fatalf("outbox not delivered %+v", pending)
+	}
+
+	// the rich deposit payload
+	config.DepositMethod = DEPOSIT_METHOD_DC3
+	if sinks, err = NewDepositSinks(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	HandleTransfer(config, store, nil, transfer("carol", "wallet", "7", "cc"))
+	NewOutbox(config, store, sinks).Flush(now)
+	if len(standIn.infos) != 1 || standIn.infos[0].Sender != "carol" || standIn.infos[0].Uid != 7 || standIn.infos[0].Status != CONFIRMATION_IRREVERSIBLE {
+		t.Fatalf("unexpected deposit info %+v", standIn.infos)
+	}
+}
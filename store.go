@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketCursor     = []byte("cursor")
+	bucketSecurity   = []byte("security")
+	bucketLedger     = []byte("ledger")
+	bucketFailed     = []byte("failed")
+	bucketOutbox     = []byte("outbox")
+	bucketDead       = []byte("deadletter")
+	bucketFees       = []byte("fees")
+	bucketBroadcasts = []byte("broadcasts")
+	bucketPending    = []byte("broadcasts_pending")
+
+	keyScanCursor   = []byte("scan")
+	keyActionCursor = []byte("actions/")
+)
+
+// Store is the embedded database of the wallet.
+type Store struct {
+	db *bolt.DB
+}
+
+func OpenStore(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		indexed := tx.Bucket(bucketPending) != nil
+		for _, name := range [][]byte{bucketCursor, bucketSecurity, bucketLedger, bucketFailed, bucketOutbox, bucketDead, bucketFees, bucketBroadcasts, bucketPending} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		if !indexed {
+			return indexPendingBroadcasts(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) get(bucket []byte, key []byte, v interface{}) (bool, error) {
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucket).Get(key)
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, v)
+	})
+	return found, err
+}
+
+func (s *Store) put(bucket []byte, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put(key, data)
+	})
+}
+
+func cursorKey(account string) []byte {
+	if account == "" {
+		return keyScanCursor
+	}
+	return append(append([]byte{}, keyActionCursor...), account...)
+}
+
+func (s *Store) loadCursor(account string) (*Cursor, error) {
+	cursor := new(Cursor)
+	found, err := s.get(bucketCursor, cursorKey(account), cursor)
+	if err != nil || !found {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+// LoadCursor returns the saved scan cursor, nil if there is none.
+func (s *Store) LoadCursor() (*Cursor, error) {
+	return s.loadCursor("")
+}
+
+// LoadActionCursor returns the saved action history cursor of the
+// account, nil if there is none.
+func (s *Store) LoadActionCursor(account string) (*Cursor, error) {
+	return s.loadCursor(account)
+}
+
+// SaveCursor saves the scan cursor, or the action history cursor of
+// cursor.Account when set.
+func (s *Store) SaveCursor(cursor *Cursor) error {
+	return s.put(bucketCursor, cursorKey(cursor.Account), cursor)
+}
+
+func (s *Store) AddSecurityEvent(event *SecurityEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketSecurity)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		return bucket.Put(key, data)
+	})
+}
+
+// SecurityEvents returns the last events, newest first.
+func (s *Store) SecurityEvents(limit int) ([]SecurityEvent, error) {
+	var events []SecurityEvent
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketSecurity).Cursor()
+		for k, v := c.Last(); k != nil && len(events) < limit; k, v = c.Prev() {
+			var event SecurityEvent
+			if err := json.Unmarshal(v, &event); err != nil {
+				return err
+			}
+			events = append(events, event)
+		}
+		return nil
+	})
+	return events, err
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openTestStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := OpenStore(filepath.Join(dir, "wallet.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return store, func() {
+		store.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRestoreCursor(t *testing.T) {
+	store, cleanup := openTestStore(t)
+	defer cleanup()
+
+	chain := newTestChain()
+	for i := uint32(1); i <= 5; i++ {
+		chain.add(i, 0)
+	}
+	chain.source.SetIrreversible(4)
+
+	// migrated from the old lastBlock key
+	config := &Config{LastBlock: 3}
+	cursor, err := RestoreCursor(config, store, chain.source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.Number != 2 || cursor.ID != "" {
+		t.Fatalf("unexpected cursor %+v", cursor)
+	}
+
+	// the configuration is ignored once a cursor is saved
+	if err = store.SaveCursor(&Cursor{Number: 4, ID: chain.ids[4].String()}); err != nil {
+		t.Fatal(err)
+	}
+	if cursor, err = RestoreCursor(config, store, chain.source); err != nil || cursor.Number != 4 {
+		t.Fatalf("unexpected cursor %+v, err %v", cursor, err)
+	}
+
+	// block 4 is replaced by a fork, the scan goes back to the last
+	// irreversible block
+	chain.add(4, 1)
+	if cursor, err = RestoreCursor(config, store, chain.source); err != nil || cursor.Number != 3 {
+		t.Fatalf("unexpected cursor %+v, err %v", cursor, err)
+	}
+
+	// or to the one saved with the cursor
+	chain.add(5, 1)
+	if err = store.SaveCursor(&Cursor{Number: 5, ID: chain.ids[5].String(), Irreversible: 2}); err != nil {
+		t.Fatal(err)
+	}
+	chain.add(5, 2)
+	if cursor, err = RestoreCursor(config, store, chain.source); err != nil || cursor.Number != 2 || cursor.ID != "" {
+		t.Fatalf("unexpected cursor %+v, err %v", cursor, err)
+	}
+	if saved, _ := store.LoadCursor(); saved == nil || saved.Number != 2 {
+		t.Fatalf("rolled back cursor not saved: %+v", saved)
+	}
+}
+
+func TestLedger(t *testing.T) {
+	store, cleanup := openTestStore(t)
+	defer cleanup()
+
+	first := &NotifyMessage{TxHash: "aa", Ordinal: 1, BlockNum: 10}
+	second := &NotifyMessage{TxHash: "aa", Ordinal: 2, BlockNum: 10}
+	if store.Delivered("wallet", LEDGER_DEPOSIT, first) {
+		t.Fatal("new transfer taken as delivered")
+	}
+	if err := store.RecordDelivery("wallet", LEDGER_DEPOSIT, first); err != nil {
+		t.Fatal(err)
+	}
+
+	// the same transfer moved to another block by a fork
+	moved := &NotifyMessage{TxHash: "aa", Ordinal: 1, BlockNum: 12}
+	if !store.Delivered("wallet", LEDGER_DEPOSIT, moved) {
+		t.Error("transfer delivered twice")
+	}
+	if store.Delivered("wallet", LEDGER_DEPOSIT, second) || store.Delivered("exchange", LEDGER_DEPOSIT, first) {
+		t.Error("other transfers taken as delivered")
+	}
+	if first.Key() != "aa:1:10" {
+		t.Errorf("unexpected key %s", first.Key())
+	}
+}
+
+func TestFailedTxs(t *testing.T) {
+	store, cleanup := openTestStore(t)
+	defer cleanup()
+
+	for _, account := range []string{"wallet", "wallet2"} {
+		message := &NotifyMessage{TxHash: "bb", Ordinal: 1, Status: "expired", Amount: big.NewInt(10000), Precision: 4}
+		if err := store.RecordFailure(account, message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	txs, err := store.FailedTxs("wallet", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 1 || txs[0].Status != "expired" || txs[0].Amount != "1.0000" {
+		t.Fatalf("unexpected failed txs %+v", txs)
+	}
+	if txs, _ = store.FailedTxs("", "bb"); len(txs) != 2 {
+		t.Errorf("got %d failed txs of bb, want 2", len(txs))
+	}
+}
@@ -1,9 +1,9 @@
 package main
 
 import (
-	"github.com/eoscanada/eos-go"
 	"log"
 	"math/big"
+	"sync"
 )
 
 const (
@@ -12,18 +12,16 @@ const (
 )
 
 type ObjMessage struct {
-	Type   int
-	Hash   string
-	Number *big.Int
+	Type         int
+	Hash         string
+	Number       *big.Int
+	Irreversible *big.Int
+	// time of the head block
+	Time int64
 }
 
-var blkPool = make(map[uint64][]NotifyMessage)
-var minAmount = new(big.Int).SetUint64(1000) //0.1000 EOS
-
-func GetNewerBlock(config *Config, ch chan<- ObjMessage) error {
-	api := eos.New(config.RPCURL)
-
-	info, err := api.GetInfo()
+func GetNewerBlock(source BlockSource, ch chan<- ObjMessage) error {
+	info, err := source.HeadInfo()
 	if err != nil {
 		log.Println("get info err:", err)
 		return err
@@ -31,123 +29,247 @@ func GetNewerBlock(config *Config, ch chan<- ObjMessage) error {
 
 	bgInt := new(big.Int)
 	bgInt.SetInt64(int64(info.HeadBlockNum))
-	ch <- ObjMessage{TYPE_BLOCK_HASH, info.HeadBlockID.String(), bgInt}
+	lib := new(big.Int)
+	lib.SetInt64(int64(info.LastIrreversibleBlockNum))
+	ch <- ObjMessage{TYPE_BLOCK_HASH, info.HeadBlockID.String(), bgInt, lib, info.HeadBlockTime.Unix()}
 	return nil
 }
 
-func Listener(config *Config, ch <-chan ObjMessage, notifyChannel chan<- NotifyMessage, last_id uint64) {
+func Listener(config *Config, source BlockSource, ch <-chan ObjMessage, notifyChannel chan<- NotifyMessage, last_id uint64) {
+	scanner := NewScanner(config, source, notifyChannel, last_id)
+
 	for message := range ch {
 		switch message.Type {
 		case TYPE_BLOCK_HASH:
-			// Recovery: We get a recent block, but the last we parsed is more older that current - 1
-			last := new(big.Int)
-			last.SetUint64(last_id)
-
-			stop := new(big.Int)
-			stop.Sub(message.Number, big.NewInt(1))
-			//log.Printf("Recovery: Doing block %s - %s", last.Text(10), message.Number.String())
-			for last.Cmp(message.Number) <= 0 {
-				//time.Sleep(10000 * time.Millisecond)
-				txns, err := ReadBlock(config, last)
-				if err != nil {
-					log.Println("Listener:", err)
-					break
-				}
-
-				if last.Cmp(stop) < 0 {
-					for _, txn := range txns {
-						notifyChannel <- txn
-					}
-
-					notifyChannel <- NotifyMessage{
-						MessageType: NOTIFY_TYPE_ADMIN,
-						Amount:      last,
-					}
-				} else {
-					//put it in map
-					if len(txns) > 0 {
-						blkPool[last.Uint64()] = txns
-						log.Println("add txs to", last.Uint64(), "txs size:", len(txns))
-					}
-					//scan and broadcast 1 confirms
-					txns, ok := blkPool[last.Uint64()-1]
-					if ok {
-						for _, txn := range txns {
-							notifyChannel <- txn
-						}
-
-						notifyChannel <- NotifyMessage{
-							MessageType: NOTIFY_TYPE_ADMIN,
-							Amount:      new(big.Int).Sub(last, big.NewInt(1)),
-						}
-
-						// delete unconfirmed height txs map
-						delete(blkPool, last.Uint64()-1)
-						log.Println("delete txs in block", last.Uint64()-1)
-					}
-				}
-
-				last.SetUint64(last.Uint64() + 1)
-				config.LastBlock = last.Uint64()
-			}
-
-			//log.Printf("Recovery is over: Done up to block %s", last.Text(10))
-			last_id = last.Uint64()
+			scanner.Scan(message.Number.Uint64(), message.Irreversible.Uint64())
 		}
 	}
 }
 
-func Notifier(config *Config, ch <-chan NotifyMessage) {
-	var (
-		from string
-		to   string
-	)
+// WatchedParties returns the watched accounts concerned by a transfer.
+// A transfer seen through the notification of one account is only for
+// that account.
+func WatchedParties(config *Config, message *NotifyMessage) []*WatchedAccount {
+	var parties []*WatchedAccount
+	for _, name := range []string{message.AddressFrom, message.AddressTo} {
+		if message.Receiver != "" && name != message.Receiver {
+			continue
+		}
+		account := config.Watched(name)
+		if account == nil || (len(parties) > 0 && parties[0] == account) {
+			continue
+		}
+		parties = append(parties, account)
+	}
+	return parties
+}
 
+func Notifier(config *Config, store *Store, security *SecurityLog, ch <-chan NotifyMessage) {
 	for message := range ch {
 		if message.MessageType == NOTIFY_TYPE_NONE {
 			continue
 		}
 
 		if message.MessageType == NOTIFY_TYPE_ADMIN {
+			// everything before it in the channel has been handled
+			if message.Cursor != nil {
+				if err := store.SaveCursor(message.Cursor); err != nil {
+					log.Println("save cursor err:", err)
+				}
+			}
 			continue
 		}
+		if message.MessageType == NOTIFY_TYPE_CLOCK {
+			TrackBroadcasts(config, store, &message)
+			continue
+		}
+
+		TrackBroadcasts(config, store, &message)
+		HandleTransfer(config, store, security, &message)
+	}
+}
 
-		from = message.AddressFrom
-		to = message.AddressTo
-		amount := LeftShift(message.Amount.String(), 4)
-		symbol := "EOS"
-		findFrom := from == config.Account
-		findTo := to == config.Account
-		fee := "0"
+const (
+	RESULT_CREDITED         = "credited"
+	RESULT_ALREADY_CREDITED = "already_credited"
+	RESULT_IGNORED          = "ignored"
+	RESULT_ERROR            = "error"
+	RESULT_RECORDED         = "recorded"
+	RESULT_REJECTED         = "rejected"
+	RESULT_REVERTED         = "reverted"
+)
 
-		if !findTo && !findFrom {
-			continue
+// TransferResult is what became of a transfer for one watched account.
+type TransferResult struct {
+	Account string `json:"account"`
+	Result  string `json:"result"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// deliveryMu keeps the notifier and a rescan from delivering the same
+// transfer between the ledger check and its record.
+var deliveryMu sync.Mutex
+
+// HandleTransfer checks a transfer and delivers it to the watched
+// accounts concerned. The rejected transfers are reported to security
+// when it is set.
+func HandleTransfer(config *Config, store *Store, security *SecurityLog, message *NotifyMessage) []TransferResult {
+	deliveryMu.Lock()
+	defer deliveryMu.Unlock()
+
+	t, rejected := CheckTransfer(config, message)
+	if rejected == SECURITY_UNKNOWN_TOKEN {
+		return nil
+	}
+	if rejected != "" {
+		account := config.Watched(message.Receiver)
+		if account == nil {
+			account = config.Watched(message.AddressTo)
+		}
+		if account == nil {
+			return []TransferResult{{Result: RESULT_REJECTED, Reason: rejected}}
 		}
+		// reported once confirmed
+		if message.MessageType == NOTIFY_TYPE_TX && security != nil {
+			security.Report(account.Name, rejected, message)
+		}
+		return []TransferResult{{Account: account.Name, Result: RESULT_REJECTED, Reason: rejected}}
+	}
 
-		if findFrom {
-			if findTo {
-				log.Printf("token transfer within the same wallet (%s: %s -> %s %s)\n", symbol, from, to, amount)
-			}
+	var results []TransferResult
+	for _, account := range WatchedParties(config, message) {
+		results = append(results, TransferResult{Account: account.Name, Result: notifyAccount(config, store, account, t, message)})
+	}
+	return results
+}
+
+func notifyAccount(config *Config, store *Store, account *WatchedAccount, t *Token, message *NotifyMessage) string {
+	if message.MessageType == NOTIFY_TYPE_REVERT {
+		log.Printf("%s: transfer reverted by fork, %s -> %s, amount: %s %s memo: %s tx: %s\n", account.Name, message.AddressFrom, message.AddressTo, LeftShift(message.Amount.String(), t.Precision), t.Symbol, message.Memo, message.TxHash)
+		return revertAccount(config, store, account, t, message)
+	}
+
+	if message.MessageType == NOTIFY_TYPE_FAILED {
+		log.Printf("%s: transfer %s, %s -> %s, amount: %s %s memo: %s tx: %s\n", account.Name, message.Status, message.AddressFrom, message.AddressTo, LeftShift(message.Amount.String(), t.Precision), t.Symbol, message.Memo, message.TxHash)
+		if err := store.RecordFailure(account.Name, message); err != nil {
+			log.Println("record failed tx err:", err)
+			return RESULT_ERROR
 		}
-		// handle confirmed wallet transaction
-		if findTo && !findFrom && message.Memo != "" {
-			log.Printf("%s %s tokens deposit to the wallet, %s -> %s, memo: %s tx: %s\n", symbol, amount, from, to, message.Memo, message.TxHash)
-			if message.Amount.Cmp(minAmount) < 0 { //ignore tiny deposit
-				log.Println("amount is too small, ignored")
-			} else {
-				uid, err := ParseMemoToUID(message.Memo)
-				if err != nil {
-					log.Println("user not found, ignored")
-					continue
-				}
-				log.Println("user ID:", uid)
-				// call the deposit interface
-				storeTokenDepositTx(config, symbol, message.TxHash, message.Memo, amount)
-			}
-		} else if !findTo && findFrom {
-			log.Printf("%s %s tokens withdraw from the wallet, %s -> %s, tx: %s fee: %s\n", symbol, amount, from, to, message.TxHash, fee)
-			// call the withdraw interface
-			storeTokenWithdrawTx(config, symbol, message.TxHash, to, amount, fee)
+		return RESULT_RECORDED
+	}
+
+	if message.MessageType == NOTIFY_TYPE_PENDING {
+		log.Printf("%s: unconfirmed transfer seen, %s -> %s, memo: %s tx: %s\n", account.Name, message.AddressFrom, message.AddressTo, message.Memo, message.TxHash)
+		return RESULT_IGNORED
+	}
+
+	from := message.AddressFrom
+	to := message.AddressTo
+	amount := LeftShift(message.Amount.String(), t.Precision)
+	symbol := t.Symbol
+	findFrom := from == account.Name
+	findTo := to == account.Name
+	fee := MinerCost(config, message)
+
+	// a transfer between watched accounts only costs resources, the
+	// sender reports it as a fee
+	if config.Watched(from) != nil && config.Watched(to) != nil {
+		if !findFrom {
+			return RESULT_IGNORED
+		}
+		log.Printf("internal token transfer (%s: %s -> %s %s) tx: %s fee: %s\n", symbol, from, to, amount, message.TxHash, fee)
+		if store.Delivered(account.Name, LEDGER_FEE, message) {
+			return RESULT_ALREADY_CREDITED
+		}
+		entry := &OutboxEntry{Kind: OUTBOX_FEE, Account: account.Name, Symbol: symbol, Hash: message.TxHash, Transfer: message.TransferID(), Addr: to, Amount: amount, Fee: fee}
+		if err := store.Enqueue(config.AccountSinks(account.Name), entry, LEDGER_FEE, message); err != nil {
+			log.Println("queue fee err:", err)
+			return RESULT_ERROR
+		}
+		return RESULT_CREDITED
+	}
+
+	// handle confirmed wallet transaction
+	if findTo && !findFrom && message.Memo != "" {
+		log.Printf("%s %s tokens deposit to the wallet, %s -> %s, memo: %s tx: %s\n", symbol, amount, from, to, message.Memo, message.TxHash)
+		if message.Amount.Cmp(account.DepositMinimum(t)) < 0 { //ignore tiny deposit
+			log.Println("amount is too small, ignored")
+			return RESULT_IGNORED
+		}
+		uid, err := ParseMemoToUID(account, message.Memo)
+		if err != nil {
+			log.Println("user not found, ignored")
+			return RESULT_IGNORED
+		}
+		log.Println("user ID:", uid)
+		if store.Delivered(account.Name, LEDGER_DEPOSIT, message) {
+			return RESULT_ALREADY_CREDITED
+		}
+		// queue the deposit event, keyed by transfer since a
+		// transaction may hold several
+		entry := &OutboxEntry{Kind: OUTBOX_DEPOSIT, Account: account.Name, Symbol: symbol, Hash: message.TxHash, Transfer: message.TransferID(), Addr: message.Memo, Amount: amount}
+		entry.Deposit = &DepositDetail{
+			Sender:       from,
+			Contract:     message.Contract,
+			Uid:          uid,
+			Memo:         message.Memo,
+			BlockNum:     message.BlockNum,
+			BlockTime:    message.BlockTime,
+			Ordinal:      message.Ordinal,
+			Confirmation: CONFIRMATION_IRREVERSIBLE,
+		}
+		if config.ConfirmPolicy == CONFIRM_BLOCKS {
+			entry.Deposit.Confirmation = CONFIRMATION_BLOCKS
+		}
+		if err := store.Enqueue(config.AccountSinks(account.Name), entry, LEDGER_DEPOSIT, message); err != nil {
+			log.Println("queue deposit err:", err)
+			return RESULT_ERROR
+		}
+		return RESULT_CREDITED
+	} else if !findTo && findFrom {
+		log.Printf("%s %s tokens withdraw from the wallet, %s -> %s, tx: %s fee: %s\n", symbol, amount, from, to, message.TxHash, fee)
+		if store.Delivered(account.Name, LEDGER_WITHDRAW, message) {
+			return RESULT_ALREADY_CREDITED
+		}
+		// queue the withdraw event
+		entry := &OutboxEntry{Kind: OUTBOX_WITHDRAW, Account: account.Name, Symbol: symbol, Hash: message.TxHash, Transfer: message.TransferID(), Addr: to, Amount: amount, Fee: fee}
+		if err := store.Enqueue(config.AccountSinks(account.Name), entry, LEDGER_WITHDRAW, message); err != nil {
+			log.Println("queue withdraw err:", err)
+			return RESULT_ERROR
+		}
+		return RESULT_CREDITED
+	}
+	return RESULT_IGNORED
+}
+
+// revertAccount takes back what was delivered for the account from a
+// transfer dropped by a fork, a transfer only seen pending is ignored.
+func revertAccount(config *Config, store *Store, account *WatchedAccount, t *Token, message *NotifyMessage) string {
+	result := RESULT_IGNORED
+	for _, ledger := range []string{LEDGER_DEPOSIT, LEDGER_WITHDRAW, LEDGER_FEE} {
+		entry := &OutboxEntry{
+			Kind:     OUTBOX_REVERT,
+			Account:  account.Name,
+			Symbol:   t.Symbol,
+			Hash:     message.TxHash,
+			Transfer: message.TransferID(),
+			Ordinal:  message.Ordinal,
+			Reverted: ledger,
+			Addr:     message.AddressTo,
+			Amount:   LeftShift(message.Amount.String(), t.Precision),
+		}
+		if ledger == LEDGER_DEPOSIT {
+			entry.Addr = message.Memo
+		}
+		reverted, err := store.Revert(config.AccountSinks(account.Name), entry, ledger, message)
+		if err != nil {
+			log.Println("queue revert err:", err)
+			return RESULT_ERROR
+		}
+		if reverted {
+			log.Println(ledger, "of", message.TransferID(), "for", account.Name, "reverted")
+			result = RESULT_REVERTED
 		}
 	}
+	return result
 }
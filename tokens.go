@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/eoscanada/eos-go"
+	"github.com/eoscanada/eos-go/token"
+	"gopkg.in/ini.v1"
+)
+
+// Token is a token of an eosio.token-standard contract handled by the
+// wallet. Amounts of the token are integers of Precision decimals.
+type Token struct {
+	Contract   string
+	Symbol     string
+	Precision  int
+	MinDeposit *big.Int
+}
+
+func (t *Token) Asset(amount int64) eos.Asset {
+	return eos.Asset{Amount: eos.Int64(amount), Symbol: eos.Symbol{Precision: uint8(t.Precision), Symbol: t.Symbol}}
+}
+
+// TransferAction builds a transfer of amount from the account.
+func (t *Token) TransferAction(from string, to string, amount int64, memo string) *eos.Action {
+	return &eos.Action{
+		Account: eos.AccountName(t.Contract),
+		Name:    eos.ActionName("transfer"),
+		Authorization: []eos.PermissionLevel{
+			{Actor: eos.AccountName(from), Permission: eos.PermissionName("active")},
+		},
+		ActionData: eos.NewActionData(token.Transfer{
+			From:     eos.AccountName(from),
+			To:       eos.AccountName(to),
+			Quantity: t.Asset(amount),
+			Memo:     memo,
+		}),
+	}
+}
+
+// EOSToken is the system token, deposits below 0.1000 EOS are ignored.
+func EOSToken() *Token {
+	return &Token{Contract: "eosio.token", Symbol: "EOS", Precision: 4, MinDeposit: big.NewInt(1000)}
+}
+
+// ParseAmount reads a non-negative amount of the token, with no more
+// decimals than its precision, in the token units.
+func (t *Token) ParseAmount(amount string) (*big.Int, error) {
+	value, ok := new(big.Int).SetString(RightShift(amount, t.Precision), 10)
+	if !ok || value.Sign() < 0 {
+		return nil, fmt.Errorf("invalid amount of %s: %s", t.Symbol, amount)
+	}
+	return value, nil
+}
+
+// loadTokens reads the [token.<SYMBOL>] sections, EOS of eosio.token is
+// always known.
+func loadTokens(cfg *ini.File) ([]*Token, error) {
+	tokens := []*Token{EOSToken()}
+
+	for _, section := range cfg.Sections() {
+		if !strings.HasPrefix(section.Name(), "token.") {
+			continue
+		}
+
+		symbol := strings.TrimPrefix(section.Name(), "token.")
+		if _, err := eos.StringToSymbolCode(symbol); err != nil {
+			return nil, fmt.Errorf("invalid token symbol %s: %v", symbol, err)
+		}
+		t := &Token{
+			Contract:  section.Key("contract").String(),
+			Symbol:    symbol,
+			Precision: section.Key("precision").MustInt(4),
+		}
+		if _, err := eos.StringToName(t.Contract); err != nil || t.Contract == "" {
+			return nil, fmt.Errorf("invalid contract of token %s: %s", symbol, t.Contract)
+		}
+		minDeposit, err := t.ParseAmount(section.Key("min_deposit").MustString("0"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid min_deposit of token %s: %s", symbol, section.Key("min_deposit").String())
+		}
+		t.MinDeposit = minDeposit
+
+		if symbol == "EOS" {
+			tokens[0] = t
+		} else {
+			tokens = append(tokens, t)
+		}
+	}
+
+	// the contracts share the transfer action of eosio.token
+	for _, t := range tokens {
+		eos.RegisterAction(eos.AccountName(t.Contract), eos.ActionName("transfer"), token.Transfer{})
+	}
+	return tokens, nil
+}
+
+// SystemToken returns the token the resources are paid in, EOS is always
+// the first one loaded.
+func (c *Config) SystemToken() *Token {
+	if len(c.Tokens) == 0 {
+		return EOSToken()
+	}
+	return c.Tokens[0]
+}
+
+// Token returns the registered token of that contract and symbol, nil
+// if there is none.
+func (c *Config) Token(contract string, symbol string) *Token {
+	for _, t := range c.Tokens {
+		if t.Contract == contract && t.Symbol == symbol {
+			return t
+		}
+	}
+	return nil
+}
+
+// TokenBySymbol returns the registered token of that symbol, nil if
+// there is none.
+func (c *Config) TokenBySymbol(symbol string) *Token {
+	for _, t := range c.Tokens {
+		if t.Symbol == symbol {
+			return t
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadTestConfig(t *testing.T, content string) (*Config, error) {
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "wallet.ini")
+	if err = ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return LoadConfiguration(path)
+}
+
+func TestLoadTokens(t *testing.T) {
+	config, err := loadTestConfig(t, testAccountsConfig+`
+[token.EOS]
+contract = eosio.token
+precision = 4
+min_deposit = 0.5
+
+[token.BTC]
+contract = btctoken1234
+precision = 8
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// EOS stays first, configured or not
+	if len(config.Tokens) != 3 || config.SystemToken().Symbol != "EOS" || config.SystemToken().MinDeposit.Int64() != 5000 {
+		t.Fatalf("unexpected tokens %+v", config.Tokens)
+	}
+	if btc := config.Token("btctoken1234", "BTC"); btc == nil || btc.Precision != 8 || btc.MinDeposit.Sign() != 0 || config.TokenBySymbol("BTC") != btc {
+		t.Errorf("unexpected BTC token %+v", btc)
+	}
+	if config.Token("eosio.token", "BTC") != nil || config.TokenBySymbol("ETH") != nil {
+		t.Error("unexpected token lookup")
+	}
+
+	for _, section := range []string{
+		"[token.eos]\ncontract = eosio.token\n",
+		"[token.BTC]\nprecision = 8\n",
+		"[token.BTC]\ncontract = btctoken1234\nmin_deposit = -1\n",
+		"[token.BTC]\ncontract = btctoken1234\nprecision = 2\nmin_deposit = 0.001\n",
+	} {
+		if _, err := loadTestConfig(t, testAccountsConfig+"\n"+section); err == nil {
+			t.Errorf("token %q accepted", strings.Split(section, "\n")[0])
+		}
+	}
+}
+
+func TestTransferAmount(t *testing.T) {
+	config := &Config{Tokens: []*Token{EOSToken()}}
+	for _, amount := range []string{"0", "-1.0000", "0.00001", "1e3", "922337203685477.5808"} {
+		if _, _, err := TransferParams(config, nil, "EOS", "bob", amount); err == nil || err.Error() != "Invalid amount" {
+			t.Errorf("amount %s gave %v, want Invalid amount", amount, err)
+		}
+	}
+}
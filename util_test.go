@@ -72,3 +72,18 @@ func TestRightShift(t *testing.T) {
 		t.Error("RightShift('299.00000000', 6) is wrong")
 	}
 }
+
+func TestParseAmount(t *testing.T) {
+	token := EOSToken()
+	for amount, want := range map[string]string{"1.2345": "12345", "0.5": "5000", "3": "30000", "0": "0"} {
+		value, err := token.ParseAmount(amount)
+		if err != nil || value.String() != want {
+			t.Errorf("%s is %v (err %v), want %s", amount, value, err, want)
+		}
+	}
+	for _, amount := range []string{"", "-1", "Inf", "NaN", "1e5", "0.00001", "1.2.3", "0x10"} {
+		if value, err := token.ParseAmount(amount); err == nil {
+			t.Errorf("%s parsed as %v", amount, value)
+		}
+	}
+}
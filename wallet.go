@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+)
+
+// The wallet operations shared by the HTTP handlers and the Tars servant.
+
+// WalletError is a request refused before it reaches the chain, Code is
+// the HTTP status of the answer.
+type WalletError struct {
+	Code int
+	Msg  string
+}
+
+func (e *WalletError) Error() string {
+	return e.Msg
+}
+
+func badRequest(msg string) error {
+	return &WalletError{Code: 400, Msg: msg}
+}
+
+// errorCode returns the HTTP status of an error of the wallet operations.
+func errorCode(err error) int {
+	if e, ok := err.(*WalletError); ok {
+		return e.Code
+	}
+	return 500
+}
+
+// TransferParams checks a transfer from the wallet account and returns
+// its token and amount in the token units.
+func TransferParams(config *Config, client *ChainClient, symbol string, to string, amount string) (*Token, *big.Int, error) {
+	t := requestToken(config, symbol)
+	if t == nil {
+		return nil, nil, badRequest("Unknown token")
+	}
+	if to == "" {
+		return nil, nil, badRequest("Missing to field")
+	}
+	if amount == "" {
+		return nil, nil, badRequest("Missing 'amount' field")
+	}
+
+	// an asset amount is a positive int64 of the token units
+	value, err := t.ParseAmount(amount)
+	if err != nil || value.Sign() <= 0 || !value.IsInt64() {
+		return nil, nil, badRequest("Invalid amount")
+	}
+
+	if !VerifyAddress(client, to) {
+		log.Println("invalid to address:", to)
+		return nil, nil, badRequest("Invalid to address")
+	}
+	return t, value, nil
+}
+
+// trackBroadcast follows a pushed transfer until it is confirmed, the
+// transfer was sent whatever happens here.
+func trackBroadcast(config *Config, store *Store, t *Token, id string, to string, amount string, memo string, expiration time.Time) {
+	b := &Broadcast{ID: id, Account: config.Account, To: to, Symbol: t.Symbol, Amount: amount, Memo: memo, Expiration: expiration.Unix()}
+	if err := store.TrackBroadcast(b); err != nil {
+		log.Println("track broadcast", id, "err:", err)
+	}
+}
+
+// SendTransfer signs and pushes a transfer from the wallet account, the
+// transaction is then tracked until it is confirmed.
+func SendTransfer(config *Config, client *ChainClient, store *Store, symbol string, to string, amount string, memo string) (string, error) {
+	t, value, err := TransferParams(config, client, symbol, to, amount)
+	if err != nil {
+		return "", err
+	}
+
+	log.Println("send", t.Symbol, "to", to, "amount:", amount)
+	tx, expiration, err := SendToken(config, client, t, to, value.Int64(), memo)
+	if err != nil {
+		log.Println("send", t.Symbol, "err:", err)
+		return "", fmt.Errorf("Could not send %s: %v", t.Symbol, err)
+	}
+	trackBroadcast(config, store, t, tx, to, LeftShift(value.String(), t.Precision), memo, expiration)
+	return tx, nil
+}
+
+// GetBalance returns the balance of an address, of the wallet account when
+// it is empty.
+func GetBalance(config *Config, client *ChainClient, symbol string, address string) (*Token, string, error) {
+	if address == "" {
+		address = config.Account
+	}
+	if !VerifyAddress(client, address) {
+		log.Println("Invalid address:", address)
+		return nil, "", badRequest("Invalid address")
+	}
+
+	t := requestToken(config, symbol)
+	if t == nil {
+		return nil, "", badRequest("Unknown token")
+	}
+
+	balance, err := GetAddressBalance(client, t, address)
+	if err != nil {
+		log.Println("get", t.Symbol, "balance of", address, "err:", err)
+		return t, "", fmt.Errorf("Could not retrieve %s balance: %v", t.Symbol, err)
+	}
+
+	log.Println("get", t.Symbol, "balance of", address, ":", balance.String())
+	return t, LeftShift(balance.String(), t.Precision), nil
+}
+
+// GetMemo returns the deposit memo of a user for a watched account, the
+// wallet account when name is empty.
+func GetMemo(config *Config, name string, uid uint64) (string, string, error) {
+	if name == "" {
+		name = config.Account
+	}
+	account := config.Watched(name)
+	if account == nil {
+		return "", name, badRequest("unknown account")
+	}
+
+	memo := CreateMemoByUID(account, uid)
+	log.Println("create memo of", uid, "for", name, ":", memo)
+	return memo, name, nil
+}
+
+// GetTxStatus returns what became of a transaction pushed by the wallet.
+func GetTxStatus(store *Store, hash string) (*Broadcast, error) {
+	if hash == "" {
+		return nil, badRequest("missing hash")
+	}
+
+	b, err := store.Broadcast(hash)
+	if err != nil {
+		log.Println("read broadcast err:", err)
+		return nil, err
+	}
+	if b == nil {
+		b = &Broadcast{ID: hash, Status: BROADCAST_UNKNOWN}
+	}
+	return b, nil
+}